@@ -0,0 +1,151 @@
+// Package address parses free-form Serbian addresses and resolves them to streets.
+package address
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/attilaolah/cad-rs/text"
+)
+
+// ErrEmpty is returned when parsing an address without a street or settlement.
+var ErrEmpty = errors.New("empty address")
+
+// Address is a parsed address.
+type Address struct {
+	Settlement string
+	// Street name, with abbreviations expanded and the street type ("ulica") removed.
+	Street string
+	// House number, or "bb" (bez broja) for addresses without a number.
+	HouseNumber string
+	// Suffix of the house number, e.g. "a" in "12a".
+	Suffix string
+}
+
+var (
+	// House number at the end of the street, with an optional "br." marker.
+	// Apartment numbers ("3/2") are dropped.
+	houseNumber = regexp.MustCompile(`(?i)^(.*?)(?:[\s,]+(?:br|бр|broj|број)\.?)?(?:[\s,]*(\d+)\s*(\pL)?(?:/\d+)?|[\s,]+(bb|бб))$`)
+
+	// Five-digit postal code before or after the settlement name.
+	postalCode = regexp.MustCompile(`^\d{5}\s+|\s+\d{5}$`)
+
+	// Abbreviations, keyed by their folded form.
+	// An empty expansion removes the word: the street type is not part of the name.
+	abbreviations = map[string]string{
+		"ul":    "",
+		"ulica": "",
+		"bul":   "Bulevar",
+		"blvd":  "Bulevar",
+		"bulev": "Bulevar",
+		"kr":    "Kralja",
+		"vojv":  "Vojvode",
+		"nas":   "Naselje",
+		"nasel": "Naselje",
+		"trg":   "Trg",
+	}
+)
+
+// Parse splits a free-form address into its parts.
+// Both "Novi Sad, Bul. oslobođenja 12a" and "ул. Краља Петра I бр. 5, Београд" are understood.
+//
+// Only the last number is taken as the house number, so numbered street names
+// are kept when followed by a house number, e.g. "Nova 5 12". Without one, as
+// in "Nova 5", the number is ambiguous; Geocode tries both readings.
+func Parse(s string) (*Address, error) {
+	parts := []string{}
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, ErrEmpty
+	}
+
+	// The street is the part with the house number, or failing that, the
+	// part starting with a street type, or failing that, the first part.
+	street := -1
+	for i, p := range parts {
+		if m := houseNumber.FindStringSubmatch(p); m != nil && m[1] != "" {
+			street = i
+			break
+		}
+	}
+	if street < 0 {
+		for i, p := range parts {
+			if _, ok := abbreviations[firstWord(p)]; ok {
+				street = i
+				break
+			}
+		}
+	}
+	if street < 0 {
+		street = 0
+	}
+
+	a := Address{}
+	if m := houseNumber.FindStringSubmatch(parts[street]); m != nil && m[1] != "" {
+		a.Street = m[1]
+		a.HouseNumber = m[2]
+		a.Suffix = strings.ToLower(m[3])
+		if m[4] != "" {
+			a.HouseNumber = "bb"
+		}
+	} else {
+		a.Street = parts[street]
+	}
+	a.Street = expand(a.Street)
+
+	// The settlement is usually last, e.g. "..., Novi Sad" or "..., 21000 Novi Sad".
+	for i := len(parts) - 1; i >= 0; i-- {
+		if i != street {
+			a.Settlement = postalCode.ReplaceAllString(parts[i], "")
+			break
+		}
+	}
+
+	if a.Street == "" && a.Settlement == "" {
+		return nil, ErrEmpty
+	}
+
+	return &a, nil
+}
+
+// String formats the address as "Street Number, Settlement".
+func (a *Address) String() string {
+	s := a.Street
+	if a.HouseNumber != "" {
+		s += " " + a.HouseNumber + a.Suffix
+	}
+	if a.Settlement != "" {
+		s += ", " + a.Settlement
+	}
+	return s
+}
+
+// Expands abbreviations and removes the street type.
+func expand(s string) string {
+	words := strings.Fields(s)
+	ret := make([]string, 0, len(words))
+	for i, w := range words {
+		exp, ok := abbreviations[text.Fold(w)]
+		// Full words are only replaced when they are the street type.
+		if !ok || (i > 0 && !strings.HasSuffix(w, ".")) {
+			ret = append(ret, w)
+			continue
+		}
+		if exp != "" {
+			ret = append(ret, exp)
+		}
+	}
+	return strings.Join(ret, " ")
+}
+
+func firstWord(s string) string {
+	if f := strings.Fields(s); len(f) > 0 {
+		return text.Fold(f[0])
+	}
+	return ""
+}
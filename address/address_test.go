@@ -0,0 +1,93 @@
+package address
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/attilaolah/cad-rs/search"
+)
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want Address
+	}{{
+		in:   "Novi Sad, Bul. oslobođenja 12a",
+		want: Address{Settlement: "Novi Sad", Street: "Bulevar oslobođenja", HouseNumber: "12", Suffix: "a"},
+	}, {
+		in:   "ул. Краља Петра I бр. 5, Београд",
+		want: Address{Settlement: "Београд", Street: "Краља Петра I", HouseNumber: "5"},
+	}, {
+		in:   "UL. ZMAJ JOVINA 3/2, 21000 Novi Sad",
+		want: Address{Settlement: "Novi Sad", Street: "ZMAJ JOVINA", HouseNumber: "3"},
+	}, {
+		in:   "Trg slobode 1, Novi Sad",
+		want: Address{Settlement: "Novi Sad", Street: "Trg slobode", HouseNumber: "1"},
+	}, {
+		in:   "TRG. Republike bb, Beograd",
+		want: Address{Settlement: "Beograd", Street: "Trg Republike", HouseNumber: "bb"},
+	}, {
+		in:   "Bačka Topola, Nova 5 12",
+		want: Address{Settlement: "Bačka Topola", Street: "Nova 5", HouseNumber: "12"},
+	}, {
+		in:   "Nova 5 br. 12b, Bačka Topola",
+		want: Address{Settlement: "Bačka Topola", Street: "Nova 5", HouseNumber: "12", Suffix: "b"},
+	}, {
+		in:   "Bul. kr. Aleksandra",
+		want: Address{Street: "Bulevar Kralja Aleksandra"},
+	}} {
+		got, err := Parse(c.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", c.in, err)
+			continue
+		}
+		if *got != c.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", c.in, *got, c.want)
+		}
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	for _, in := range []string{"", " , ,"} {
+		if _, err := Parse(in); !errors.Is(err, ErrEmpty) {
+			t.Errorf("Parse(%q) error = %v, want ErrEmpty", in, err)
+		}
+	}
+}
+
+func TestGeocodeNumberedStreet(t *testing.T) {
+	idx := search.New()
+	for _, d := range []*search.Doc{
+		{Kind: search.Street, MunicipalityID: 80047, Settlement: "BAČKA TOPOLA", StreetID: 1, Street: "NOVA"},
+		{Kind: search.Street, MunicipalityID: 80047, Settlement: "BAČKA TOPOLA", StreetID: 5, Street: "NOVA 5"},
+		{Kind: search.Street, MunicipalityID: 80047, Settlement: "BAČKA TOPOLA", StreetID: 7, Street: "GLAVNA"},
+	} {
+		idx.Add(d)
+	}
+	g := NewGeocoder(idx)
+
+	for _, c := range []struct {
+		in          string
+		streetID    int64
+		houseNumber string
+	}{
+		{"Nova 5, Bačka Topola", 5, ""},
+		{"Nova 5 12, Bačka Topola", 5, "12"},
+		{"Nova 5a, Bačka Topola", 1, "5"},
+		{"Glavna 5, Bačka Topola", 7, "5"},
+	} {
+		ms, err := g.Geocode(c.in)
+		if err != nil {
+			t.Errorf("Geocode(%q): %v", c.in, err)
+			continue
+		}
+		if len(ms) == 0 {
+			t.Errorf("Geocode(%q) found no streets", c.in)
+			continue
+		}
+		if ms[0].StreetID != c.streetID || ms[0].HouseNumber != c.houseNumber {
+			t.Errorf("Geocode(%q) = street %d, number %q; want street %d, number %q",
+				c.in, ms[0].StreetID, ms[0].HouseNumber, c.streetID, c.houseNumber)
+		}
+	}
+}
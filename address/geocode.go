@@ -0,0 +1,132 @@
+package address
+
+import (
+	"strings"
+
+	"github.com/attilaolah/cad-rs/search"
+	"github.com/attilaolah/cad-rs/text"
+)
+
+// MaxEdits is the number of typos tolerated per word when resolving streets.
+const MaxEdits = 1
+
+// Match is an address resolved to a street.
+type Match struct {
+	*Address
+
+	StreetID       int64
+	MunicipalityID int64
+	// Canonical names, as found in the dataset.
+	SettlementName string
+	StreetName     string
+
+	// Confidence between 0 and 1.
+	Confidence float64
+}
+
+// Geocoder resolves addresses to streets.
+type Geocoder struct {
+	idx *search.Index
+}
+
+// NewGeocoder creates a geocoder using a search index (see search.FromDataset).
+func NewGeocoder(idx *search.Index) *Geocoder {
+	return &Geocoder{idx: idx}
+}
+
+// Geocode parses the address and returns candidate streets, best first.
+// If municipality IDs are given, only streets in those municipalities are considered.
+func (g *Geocoder) Geocode(s string, municipalityIDs ...int64) ([]*Match, error) {
+	a, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if a.Street == "" {
+		return []*Match{}, nil
+	}
+
+	// A numbered street name without a house number, e.g. "Nova 5", parses as
+	// street "Nova" with house number 5. Prefer the numbered street if it exists.
+	if a.HouseNumber != "" && a.HouseNumber != "bb" && a.Suffix == "" {
+		n := *a
+		n.Street, n.HouseNumber = a.Street+" "+a.HouseNumber, ""
+		if ms := g.geocode(&n, municipalityIDs); len(ms) > 0 && text.Fold(ms[0].StreetName) == text.Fold(n.Street) {
+			return ms, nil
+		}
+	}
+
+	return g.geocode(a, municipalityIDs), nil
+}
+
+// Resolves a parsed address.
+func (g *Geocoder) geocode(a *Address, municipalityIDs []int64) []*Match {
+	// Street documents are indexed by their full name, "Settlement, Street".
+	query := a.Street
+	if a.Settlement != "" {
+		query = a.Settlement + ", " + a.Street
+	}
+
+	results := g.idx.Search(query, search.Options{
+		Kinds:           []search.Kind{search.Street},
+		MunicipalityIDs: municipalityIDs,
+		MaxEdits:        MaxEdits,
+	})
+
+	ms := make([]*Match, len(results))
+	for i, r := range results {
+		ms[i] = &Match{
+			Address:        a,
+			StreetID:       r.StreetID,
+			MunicipalityID: r.MunicipalityID,
+			SettlementName: r.Settlement,
+			StreetName:     r.Street,
+			Confidence:     confidence(a, &r),
+		}
+	}
+
+	// Equally good candidates are ambiguous.
+	if len(results) > 1 && same(&results[0], &results[1]) {
+		for _, m := range ms {
+			m.Confidence /= 2
+		}
+	}
+
+	return ms
+}
+
+func confidence(a *Address, r *search.Result) float64 {
+	c := 0.0
+	switch r.Match {
+	case search.Exact:
+		c = 1
+	case search.Prefix:
+		c = 0.9
+	case search.Token:
+		c = 0.8
+	case search.Fuzzy:
+		c = 0.7 - 0.1*float64(r.Edits)
+	}
+
+	switch {
+	case a.Settlement == "":
+		// The street name alone is likely to exist in many settlements.
+		c *= 0.7
+	case text.Fold(a.Settlement) != text.Fold(r.Settlement):
+		// The query only matched parts of the settlement name.
+		c *= 0.8
+	}
+
+	// Streets matched by their name alone, not just by a longer prefix.
+	if text.Fold(a.Street) != text.Fold(r.Street) && !strings.HasPrefix(text.Fold(r.Street), text.Fold(a.Street)) {
+		c *= 0.9
+	}
+
+	if c < 0 {
+		return 0
+	}
+	return c
+}
+
+func same(a, b *search.Result) bool {
+	return a.Match == b.Match && a.Edits == b.Edits
+}
@@ -0,0 +1,324 @@
+// Package api serves the dataset as a read-only JSON REST API.
+//
+// Endpoints:
+//
+//	GET /municipalities?q=&offset=&limit=
+//	GET /municipalities/{id}
+//	GET /municipalities/{id}/settlements?q=&offset=&limit=
+//	GET /cadastral-municipalities/{id}
+//	GET /streets/{id}
+//
+// The q parameter filters by name, regardless of script, case and diacritics.
+// Responses carry Last-Modified (the latest updated_at of the returned
+// entities) and ETag headers, and are gzip-compressed when accepted.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/attilaolah/cad-rs/cadrs"
+	"github.com/attilaolah/cad-rs/pbjson"
+	pb "github.com/attilaolah/cad-rs/proto"
+)
+
+// Pagination limits.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+var errBadRequest = errors.New("bad request")
+
+// Server is an http.Handler serving the dataset.
+type Server struct {
+	ds *cadrs.Live
+}
+
+// New creates a new server for the dataset, which may be reloaded while serving.
+func New(ds *cadrs.Live) *Server {
+	return &Server{ds: ds}
+}
+
+// A response body, with the update times of the contained entities.
+type response struct {
+	body    interface{}
+	updated []*timestamppb.Timestamp
+}
+
+// A page of results.
+type page struct {
+	Items  json.RawMessage `json:"items"`
+	Total  int             `json:"total"`
+	Offset int             `json:"offset"`
+	Limit  int             `json:"limit"`
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	res, err := s.route(s.ds.Dataset(), r)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, cadrs.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, errBadRequest):
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	data, err := pbjson.Marshal(res.body)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	data = append(data, '\n')
+
+	h := fnv.New64a()
+	h.Write(data)
+	etag := fmt.Sprintf(`"%x"`, h.Sum64())
+	modified := lastModified(res.updated)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeBody(w, r, http.StatusOK, data)
+}
+
+func (s *Server) route(ds *cadrs.Dataset, r *http.Request) (*response, error) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "municipalities":
+		return municipalities(ds, r)
+	case len(parts) == 2 && parts[0] == "municipalities":
+		id, err := parseID(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		return municipality(ds, id)
+	case len(parts) == 3 && parts[0] == "municipalities" && parts[2] == "settlements":
+		id, err := parseID(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		return settlements(ds, id, r)
+	case len(parts) == 2 && parts[0] == "cadastral-municipalities":
+		id, err := parseID(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		return cadastralMunicipality(ds, id)
+	case len(parts) == 2 && parts[0] == "streets":
+		id, err := parseID(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		return street(ds, id)
+	}
+
+	return nil, fmt.Errorf("path %q: %w", r.URL.Path, cadrs.ErrNotFound)
+}
+
+func municipalities(ds *cadrs.Dataset, r *http.Request) (*response, error) {
+	ms, err := ds.Municipalities()
+	if err != nil {
+		return nil, err
+	}
+
+	q := cadrs.Normalize(r.URL.Query().Get("q"))
+	items := []*pb.Municipality{}
+	for _, m := range ms {
+		if strings.Contains(cadrs.Normalize(m.Name), q) {
+			items = append(items, m.Municipality)
+		}
+	}
+
+	return paginate(r, items)
+}
+
+func municipality(ds *cadrs.Dataset, id int64) (*response, error) {
+	m, err := ds.Municipality(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return single(m.Municipality), nil
+}
+
+func settlements(ds *cadrs.Dataset, id int64, r *http.Request) (*response, error) {
+	m, err := ds.Municipality(id)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := m.Settlements()
+	if err != nil {
+		return nil, err
+	}
+
+	q := cadrs.Normalize(r.URL.Query().Get("q"))
+	items := []*pb.Settlement{}
+	for _, s := range ss {
+		if strings.Contains(cadrs.Normalize(s.Name), q) {
+			items = append(items, s.Settlement)
+		}
+	}
+
+	return paginate(r, items)
+}
+
+func cadastralMunicipality(ds *cadrs.Dataset, id int64) (*response, error) {
+	cm, err := ds.CadastralMunicipality(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return single(cm.CadastralMunicipality), nil
+}
+
+func street(ds *cadrs.Dataset, id int64) (*response, error) {
+	st, err := ds.Street(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return single(st.Street), nil
+}
+
+// A message with an update time.
+type entity interface {
+	proto.Message
+	GetUpdatedAt() *timestamppb.Timestamp
+}
+
+func single(e entity) *response {
+	return &response{
+		body:    e,
+		updated: []*timestamppb.Timestamp{e.GetUpdatedAt()},
+	}
+}
+
+func paginate[T entity](r *http.Request, items []T) (*response, error) {
+	offset, err := intParam(r, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := intParam(r, "limit", DefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	p := page{
+		Total:  len(items),
+		Offset: offset,
+		Limit:  limit,
+	}
+	if offset > len(items) {
+		offset = len(items)
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	items = items[offset:end]
+
+	if p.Items, err = pbjson.Marshal(items); err != nil {
+		return nil, err
+	}
+
+	res := response{
+		body:    p,
+		updated: make([]*timestamppb.Timestamp, len(items)),
+	}
+	for i, item := range items {
+		res.updated[i] = item.GetUpdatedAt()
+	}
+
+	return &res, nil
+}
+
+func parseID(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q: %w", s, errBadRequest)
+	}
+	return id, nil
+}
+
+func intParam(r *http.Request, name string, def int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, s, errBadRequest)
+	}
+	return n, nil
+}
+
+// Returns the latest of the update times, truncated to HTTP precision.
+func lastModified(ts []*timestamppb.Timestamp) time.Time {
+	ret := time.Time{}
+	for _, t := range ts {
+		if t != nil && t.AsTime().After(ret) {
+			ret = t.AsTime()
+		}
+	}
+	return ret.Truncate(time.Second)
+}
+
+// Reports whether the client's cached copy is still fresh.
+// If-None-Match takes precedence over If-Modified-Since (RFC 9110).
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+			if t == etag || t == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.After(t)
+	}
+
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,202 @@
+// Package atomicfile provides crash-safe file and directory replacement.
+//
+// Data is always written to a temporary location first, synced to disk and
+// then renamed into place, so readers (and crashes) never observe a partially
+// written file.
+package atomicfile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// WriteFile atomically replaces the named file with data.
+// The parent directory must already exist.
+func WriteFile(name string, data []byte, perm os.FileMode) (err error) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %q: %w", name, err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return fmt.Errorf("failed to write %q: %w", tmp.Name(), err)
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set permissions of %q: %w", tmp.Name(), err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %q: %w", tmp.Name(), err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %q: %w", tmp.Name(), err)
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to rename %q to %q: %w", tmp.Name(), name, err)
+	}
+
+	return SyncDir(dir)
+}
+
+// ReplaceDir replaces the directory dst with src.
+// Both must reside on the same file system.
+//
+// Where the file system supports it, the two directories are exchanged in a
+// single rename, and the old contents are removed afterwards. Otherwise, the old
+// directory is first renamed out of the way, so a crash can leave dst missing,
+// with the old contents still next to it; RecoverDir puts them back.
+func ReplaceDir(dst, src string) error {
+	parent := filepath.Dir(dst)
+
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		if err := os.Rename(src, dst); err != nil {
+			return fmt.Errorf("failed to rename %q to %q: %w", src, dst, err)
+		}
+		return SyncDir(parent)
+	} else if err != nil {
+		return fmt.Errorf("failed to stat %q: %w", dst, err)
+	}
+
+	if err := exchange(src, dst); err != nil {
+		return fmt.Errorf("failed to exchange %q and %q: %w", src, dst, err)
+	}
+	if err := SyncDir(parent); err != nil {
+		return err
+	}
+
+	// src now holds the old contents.
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("failed to remove %q: %w", src, err)
+	}
+	return nil
+}
+
+// Exchanges two directories using two renames, through a temporary directory
+// next to b. Only used where an atomic exchange is not available.
+func swapRename(a, b string) error {
+	tmp, err := os.MkdirTemp(filepath.Dir(b), "."+filepath.Base(b)+".*.old")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory for %q: %w", b, err)
+	}
+	old := filepath.Join(tmp, filepath.Base(b))
+
+	if err := os.Rename(b, old); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rename %q to %q: %w", b, old, err)
+	}
+	if err := os.Rename(a, b); err != nil {
+		// Try to restore the old contents.
+		os.Rename(old, b)
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rename %q to %q: %w", a, b, err)
+	}
+	if err := os.Rename(old, a); err != nil {
+		return fmt.Errorf("failed to rename %q to %q: %w", old, a, err)
+	}
+	return os.Remove(tmp)
+}
+
+// RecoverDir cleans up after a ReplaceDir of dst that was interrupted.
+// If dst is missing but its old contents are still around, they are put back;
+// any other leftovers are removed.
+func RecoverDir(dst string) error {
+	parent, base := filepath.Split(dst)
+	if parent == "" {
+		parent = "."
+	}
+	entries, err := os.ReadDir(parent)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read directory %q: %w", parent, err)
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || !strings.HasPrefix(name, "."+base+".") || !strings.HasSuffix(name, ".old") {
+			continue
+		}
+		if _, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "."+base+"."), ".old"), 10, 64); err != nil {
+			continue // not created by swapRename
+		}
+
+		tmp := filepath.Join(parent, name)
+		old := filepath.Join(tmp, base)
+		if _, err := os.Lstat(dst); os.IsNotExist(err) {
+			if err := os.Rename(old, dst); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to restore %q from %q: %w", dst, old, err)
+			}
+		}
+		if err := os.RemoveAll(tmp); err != nil {
+			return fmt.Errorf("failed to remove %q: %w", tmp, err)
+		}
+	}
+
+	return nil
+}
+
+// LinkMissing hard-links all files in src that are missing from dst.
+// This is used to carry over files that are not (re-)written into a staging
+// directory before it replaces the original.
+func LinkMissing(dst, src string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.WalkDir(src, func(fn string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(src, fn)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+		if _, err := os.Lstat(target); err == nil {
+			return nil // already written
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to stat %q: %w", target, err)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory %q: %w", filepath.Dir(target), err)
+		}
+		if err := os.Link(fn, target); err != nil {
+			return fmt.Errorf("failed to link %q to %q: %w", fn, target, err)
+		}
+
+		return nil
+	})
+}
+
+// SyncDir syncs a directory, making preceding renames in it durable.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %q: %w", dir, err)
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return fmt.Errorf("failed to sync directory %q: %w", dir, err)
+	}
+	if err := d.Close(); err != nil {
+		return fmt.Errorf("failed to close directory %q: %w", dir, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,17 @@
+package atomicfile
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// Atomically exchanges two directories.
+// Falls back to two renames on file systems that don't support RENAME_EXCHANGE.
+func exchange(a, b string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) {
+		return swapRename(a, b)
+	}
+	return err
+}
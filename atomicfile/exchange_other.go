@@ -0,0 +1,8 @@
+//go:build !linux
+
+package atomicfile
+
+// Exchanges two directories, using two renames.
+func exchange(a, b string) error {
+	return swapRename(a, b)
+}
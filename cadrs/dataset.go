@@ -0,0 +1,339 @@
+// Package cadrs provides typed, read-only access to the scraped dataset.
+//
+// The dataset is the directory layout written by the fetch_* commands (see
+// README.md). Files are only read when first needed and are cached for the
+// lifetime of the Dataset.
+package cadrs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/attilaolah/cad-rs/pbjson"
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/text"
+)
+
+// ErrNotFound is returned when looking up an entity that does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Dataset is a read-only view of the scraped dataset.
+// It is safe for concurrent use.
+type Dataset struct {
+	fsys fs.FS
+
+	mu             sync.Mutex
+	ids            []int64
+	municipalities map[int64]*Municipality
+	settlements    map[int64][]*Settlement
+	// Indexes by ID, built on first use.
+	cmsByID     map[int64]*CadastralMunicipality
+	streetsByID map[int64]*Street
+	// State of each file read so far, for Changed.
+	files map[string]fileState
+}
+
+// Size and modification time of a file; the zero value for missing files.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+func stateOf(fi fs.FileInfo) fileState {
+	return fileState{size: fi.Size(), modTime: fi.ModTime()}
+}
+
+// Open opens the dataset stored in dir.
+func Open(dir string) *Dataset {
+	return OpenFS(os.DirFS(dir))
+}
+
+// OpenFS opens the dataset stored in fsys.
+func OpenFS(fsys fs.FS) *Dataset {
+	return &Dataset{
+		fsys:           fsys,
+		municipalities: map[int64]*Municipality{},
+		settlements:    map[int64][]*Settlement{},
+		files:          map[string]fileState{},
+	}
+}
+
+// Changed reports whether any of the files read so far has changed, appeared
+// or disappeared since it was read. Files that were never read are not checked,
+// so this is cheap even for a large dataset.
+func (ds *Dataset) Changed() (bool, error) {
+	ds.mu.Lock()
+	files := make(map[string]fileState, len(ds.files))
+	for name, st := range ds.files {
+		files[name] = st
+	}
+	ds.mu.Unlock()
+
+	for name, old := range files {
+		cur := fileState{}
+		if fi, err := fs.Stat(ds.fsys, name); err == nil {
+			cur = stateOf(fi)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return false, fmt.Errorf("failed to stat %q: %w", name, err)
+		}
+		if !cur.modTime.Equal(old.modTime) || cur.size != old.size {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Municipalities returns all municipalities, in the order of municipalities/ids.json.
+func (ds *Dataset) Municipalities() ([]*Municipality, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.ids == nil {
+		ids := []int64{}
+		if err := ds.read("municipalities/ids.json", &ids); err != nil {
+			return nil, err
+		}
+		ds.ids = ids
+	}
+
+	ms := make([]*Municipality, len(ds.ids))
+	for i, id := range ds.ids {
+		m, err := ds.municipality(id)
+		if err != nil {
+			return nil, err
+		}
+		ms[i] = m
+	}
+
+	return ms, nil
+}
+
+// Municipality returns the municipality with the given ID.
+func (ds *Dataset) Municipality(id int64) (*Municipality, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.municipality(id)
+}
+
+// CadastralMunicipality returns the cadastral municipality with the given ID.
+func (ds *Dataset) CadastralMunicipality(id int64) (*CadastralMunicipality, error) {
+	ms, err := ds.Municipalities()
+	if err != nil {
+		return nil, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.cmsByID == nil {
+		ds.cmsByID = map[int64]*CadastralMunicipality{}
+		for _, m := range ms {
+			for _, cm := range m.cms {
+				if _, ok := ds.cmsByID[cm.Id]; !ok {
+					ds.cmsByID[cm.Id] = cm
+				}
+			}
+		}
+	}
+	if cm, ok := ds.cmsByID[id]; ok {
+		return cm, nil
+	}
+
+	return nil, fmt.Errorf("cadastral municipality %d: %w", id, ErrNotFound)
+}
+
+// Street returns the street with the given ID.
+// The first lookup loads the settlements of all municipalities.
+func (ds *Dataset) Street(id int64) (*Street, error) {
+	ds.mu.Lock()
+	idx := ds.streetsByID
+	ds.mu.Unlock()
+
+	if idx == nil {
+		idx = map[int64]*Street{}
+		if err := ds.EachStreet(func(st *Street) error {
+			if _, ok := idx[st.Id]; !ok {
+				idx[st.Id] = st
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+		ds.mu.Lock()
+		ds.streetsByID = idx
+		ds.mu.Unlock()
+	}
+
+	if st, ok := idx[id]; ok {
+		return st, nil
+	}
+	return nil, fmt.Errorf("street %d: %w", id, ErrNotFound)
+}
+
+// EachStreet calls fn for each street of each municipality.
+// Iteration stops at the first error returned by fn.
+func (ds *Dataset) EachStreet(fn func(*Street) error) error {
+	ms, err := ds.Municipalities()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range ms {
+		ss, err := m.Settlements()
+		if err != nil {
+			return err
+		}
+		for _, s := range ss {
+			for _, st := range s.Streets {
+				if err := fn(st); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// MunicipalitiesByName returns municipalities matching name.
+// Names are compared regardless of script, case and diacritics.
+func (ds *Dataset) MunicipalitiesByName(name string) ([]*Municipality, error) {
+	ms, err := ds.Municipalities()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Municipality{}
+	for _, m := range ms {
+		if match(m.Name, name) {
+			ret = append(ret, m)
+		}
+	}
+
+	return ret, nil
+}
+
+// CadastralMunicipalitiesByName returns cadastral municipalities matching name.
+func (ds *Dataset) CadastralMunicipalitiesByName(name string) ([]*CadastralMunicipality, error) {
+	ms, err := ds.Municipalities()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*CadastralMunicipality{}
+	for _, m := range ms {
+		for _, cm := range m.cms {
+			if match(cm.Name, name) {
+				ret = append(ret, cm)
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// StreetsByName returns streets matching name.
+// The name may be either the name within the settlement, or the full name.
+func (ds *Dataset) StreetsByName(name string) ([]*Street, error) {
+	ret := []*Street{}
+	err := ds.EachStreet(func(st *Street) error {
+		if match(st.Name, name) || match(st.FullName, name) {
+			ret = append(ret, st)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Caller must hold ds.mu.
+func (ds *Dataset) municipality(id int64) (*Municipality, error) {
+	if m, ok := ds.municipalities[id]; ok {
+		return m, nil
+	}
+
+	pm := pb.Municipality{}
+	if err := ds.read(fmt.Sprintf("municipalities/%d.json", id), &pm); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("municipality %d: %w", id, ErrNotFound)
+		}
+		return nil, err
+	}
+
+	m := newMunicipality(ds, &pm)
+	ds.municipalities[id] = m
+	return m, nil
+}
+
+func (ds *Dataset) loadSettlements(m *Municipality) ([]*Settlement, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ss, ok := ds.settlements[m.Id]; ok {
+		return ss, nil
+	}
+
+	pss := []*pb.Settlement{}
+	err := ds.read(fmt.Sprintf("municipalities/%d/settlements+streets.json", m.Id), &pss)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	ss := make([]*Settlement, len(pss))
+	for i, ps := range pss {
+		ss[i] = newSettlement(m, ps)
+	}
+	ds.settlements[m.Id] = ss
+
+	return ss, nil
+}
+
+// Caller must hold ds.mu.
+func (ds *Dataset) read(name string, v interface{}) error {
+	f, err := ds.fsys.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		ds.files[name] = fileState{}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", name, err)
+	}
+	defer f.Close()
+
+	// Stat the open file, so the state matches the data even if the file is
+	// replaced in the meantime.
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %q: %w", name, err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", name, err)
+	}
+	ds.files[name] = stateOf(fi)
+	if err := pbjson.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %q: %w", name, err)
+	}
+
+	return nil
+}
+
+func match(a, b string) bool {
+	return a != "" && Normalize(a) == Normalize(b)
+}
+
+// Normalize returns the key used when comparing names.
+// See text.Fold for details.
+func Normalize(s string) string {
+	return text.Fold(s)
+}
@@ -0,0 +1,96 @@
+package cadrs_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/attilaolah/cad-rs/cadrs"
+)
+
+func testDataset() *cadrs.Dataset {
+	return cadrs.OpenFS(fstest.MapFS{
+		"municipalities/ids.json": {Data: []byte(`[70017,80438]`)},
+		"municipalities/70017.json": {Data: []byte(`{
+			"id": "70017", "name": "ALEKSANDROVAC",
+			"cadastral_municipalities": [{"id": "700029", "name": "ALEKSANDROVAC"}]
+		}`)},
+		"municipalities/80438.json": {Data: []byte(`{
+			"id": "80438", "name": "NOVI SAD",
+			"cadastral_municipalities": [{"id": "801046", "name": "NOVI SAD I"}, {"id": "801054", "name": "NOVI SAD II"}]
+		}`)},
+		"municipalities/80438/settlements+streets.json": {Data: []byte(`[{
+			"name": "NOVI SAD",
+			"streets": [{"id": "1", "name": "GLAVNA"}, {"id": "2", "name": "NOVA 5"}]
+		}, {
+			"name": "KAĆ",
+			"streets": [{"id": "3", "name": "GLAVNA"}]
+		}]`)},
+	})
+}
+
+func TestDatasetLookups(t *testing.T) {
+	ds := testDataset()
+
+	for _, c := range []struct {
+		id   int64
+		name string
+		mID  int64
+	}{
+		{700029, "ALEKSANDROVAC", 70017},
+		{801054, "NOVI SAD II", 80438},
+	} {
+		cm, err := ds.CadastralMunicipality(c.id)
+		if err != nil {
+			t.Errorf("CadastralMunicipality(%d): %v", c.id, err)
+			continue
+		}
+		if cm.Name != c.name || cm.Municipality.Id != c.mID {
+			t.Errorf("CadastralMunicipality(%d) = %q in %d, want %q in %d", c.id, cm.Name, cm.Municipality.Id, c.name, c.mID)
+		}
+	}
+	if _, err := ds.CadastralMunicipality(1); !errors.Is(err, cadrs.ErrNotFound) {
+		t.Errorf("CadastralMunicipality(1) error = %v, want ErrNotFound", err)
+	}
+
+	for _, c := range []struct {
+		id         int64
+		name       string
+		settlement string
+	}{
+		{1, "GLAVNA", "NOVI SAD"},
+		{3, "GLAVNA", "KAĆ"},
+	} {
+		st, err := ds.Street(c.id)
+		if err != nil {
+			t.Errorf("Street(%d): %v", c.id, err)
+			continue
+		}
+		if st.Name != c.name || st.Settlement.Name != c.settlement || st.Municipality().Id != 80438 {
+			t.Errorf("Street(%d) = %q in %q, want %q in %q", c.id, st.Name, st.Settlement.Name, c.name, c.settlement)
+		}
+	}
+	if _, err := ds.Street(4); !errors.Is(err, cadrs.ErrNotFound) {
+		t.Errorf("Street(4) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDatasetByName(t *testing.T) {
+	ds := testDataset()
+
+	ms, err := ds.MunicipalitiesByName("Нови Сад")
+	if err != nil {
+		t.Fatalf("MunicipalitiesByName(): %v", err)
+	}
+	if len(ms) != 1 || ms[0].Id != 80438 {
+		t.Errorf("MunicipalitiesByName() = %v, want 80438", ms)
+	}
+
+	sts, err := ds.StreetsByName("glavna")
+	if err != nil {
+		t.Fatalf("StreetsByName(): %v", err)
+	}
+	if len(sts) != 2 {
+		t.Errorf("StreetsByName() found %d streets, want 2", len(sts))
+	}
+}
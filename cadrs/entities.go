@@ -0,0 +1,81 @@
+package cadrs
+
+import (
+	pb "github.com/attilaolah/cad-rs/proto"
+)
+
+// Municipality is a municipality in the dataset.
+type Municipality struct {
+	*pb.Municipality
+
+	ds  *Dataset
+	cms []*CadastralMunicipality
+}
+
+// CadastralMunicipalities returns all cadastral municipalities.
+func (m *Municipality) CadastralMunicipalities() []*CadastralMunicipality {
+	return m.cms
+}
+
+// Settlements returns all settlements, loading them (and their streets) if needed.
+// Municipalities without scraped streets have no settlements.
+func (m *Municipality) Settlements() ([]*Settlement, error) {
+	return m.ds.loadSettlements(m)
+}
+
+// CadastralMunicipality is a cadastral municipality in the dataset.
+type CadastralMunicipality struct {
+	*pb.CadastralMunicipality
+
+	Municipality *Municipality
+}
+
+// Settlement is a settlement in the dataset.
+type Settlement struct {
+	*pb.Settlement
+
+	Municipality *Municipality
+	Streets      []*Street
+}
+
+// Street is a street in the dataset.
+type Street struct {
+	*pb.Street
+
+	Settlement *Settlement
+}
+
+// Municipality returns the municipality of the street's settlement.
+func (st *Street) Municipality() *Municipality {
+	return st.Settlement.Municipality
+}
+
+func newMunicipality(ds *Dataset, pm *pb.Municipality) *Municipality {
+	m := Municipality{
+		Municipality: pm,
+		ds:           ds,
+		cms:          make([]*CadastralMunicipality, len(pm.CadastralMunicipalities)),
+	}
+	for i, cm := range pm.CadastralMunicipalities {
+		m.cms[i] = &CadastralMunicipality{
+			CadastralMunicipality: cm,
+			Municipality:          &m,
+		}
+	}
+	return &m
+}
+
+func newSettlement(m *Municipality, ps *pb.Settlement) *Settlement {
+	s := Settlement{
+		Settlement:   ps,
+		Municipality: m,
+		Streets:      make([]*Street, len(ps.Streets)),
+	}
+	for i, st := range ps.Streets {
+		s.Streets[i] = &Street{
+			Street:     st,
+			Settlement: &s,
+		}
+	}
+	return &s
+}
@@ -0,0 +1,172 @@
+package cadrs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/attilaolah/cad-rs/atomicfile"
+)
+
+// HTTPFS is a file system reading the dataset from a web server.
+//
+// Files are cached in a local directory. Cached files are revalidated using
+// ETag and If-Modified-Since headers each time they are opened; if the server
+// cannot be reached, the cached copy is used as is.
+type HTTPFS struct {
+	// Base URL, e.g. "https://raw.githubusercontent.com/attilaolah/cad-rs/dist/".
+	BaseURL string
+	// Cache directory.
+	CacheDir string
+	// HTTP client. If nil, a client with DefaultTimeout is used.
+	Client *http.Client
+}
+
+// DefaultTimeout limits requests made without a custom client, so that an
+// unresponsive server falls back to the cache instead of blocking forever.
+const DefaultTimeout = 30 * time.Second
+
+var defaultClient = &http.Client{Timeout: DefaultTimeout}
+
+// Validators stored next to each cached file.
+type cacheMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// OpenURL opens the dataset published at baseURL, caching files in cacheDir.
+func OpenURL(baseURL, cacheDir string) *Dataset {
+	return OpenFS(&HTTPFS{
+		BaseURL:  baseURL,
+		CacheDir: cacheDir,
+	})
+}
+
+// Open implements fs.FS.
+func (h *HTTPFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	fn := filepath.Join(h.CacheDir, filepath.FromSlash(name))
+	if err := h.fetch(name, fn); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		if _, serr := os.Stat(fn); serr != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		// Fall back to the cached copy.
+	}
+
+	return os.Open(fn)
+}
+
+// Downloads name to fn, unless the cached copy is still fresh.
+func (h *HTTPFS) fetch(name, fn string) error {
+	u, err := h.url(name)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %q: %w", u, err)
+	}
+
+	meta := cacheMeta{}
+	if _, err := os.Stat(fn); err == nil {
+		if data, err := os.ReadFile(metaName(fn)); err == nil {
+			// A corrupt meta file simply results in a full download.
+			json.Unmarshal(data, &meta)
+		}
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	client := h.Client
+	if client == nil {
+		client = defaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %q: %w", u, err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil
+	case http.StatusNotFound:
+		os.Remove(fn)
+		os.Remove(metaName(fn))
+		return fs.ErrNotExist
+	default:
+		return fmt.Errorf("failed to fetch %q: unexpected status: %s", u, res.Status)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", u, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", filepath.Dir(fn), err)
+	}
+	if err := atomicfile.WriteFile(fn, data, 0o644); err != nil {
+		return err
+	}
+
+	meta = cacheMeta{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}
+	data, err = json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache metadata: %w", err)
+	}
+
+	return atomicfile.WriteFile(metaName(fn), data, 0o644)
+}
+
+func (h *HTTPFS) url(name string) (string, error) {
+	base, err := url.Parse(h.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse base URL %q: %w", h.BaseURL, err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	ref, err := url.Parse(escapePath(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse path %q: %w", name, err)
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+// Escapes each path element, so that e.g. "+" survives the round trip.
+func escapePath(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Cache metadata is kept in a dot-file next to the cached file.
+func metaName(fn string) string {
+	dir, base := filepath.Split(fn)
+	return filepath.Join(dir, "."+base+".meta")
+}
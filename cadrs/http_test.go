@@ -0,0 +1,194 @@
+package cadrs_test
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/attilaolah/cad-rs/cadrs"
+	"github.com/attilaolah/cad-rs/pbjson"
+	pb "github.com/attilaolah/cad-rs/proto"
+)
+
+// A file server that sets ETags and records requests.
+type server struct {
+	*httptest.Server
+	dir string
+
+	mu       sync.Mutex
+	requests []string
+	notMod   int
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+
+	s := server{dir: t.TempDir()}
+	files := http.FileServer(http.Dir(s.dir))
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(r.URL.Path)))
+		if err == nil {
+			w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha1.Sum(data)))
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.Path)
+		if r.Header.Get("If-None-Match") != "" && r.Header.Get("If-None-Match") == w.Header().Get("ETag") {
+			s.notMod++
+		}
+		s.mu.Unlock()
+
+		files.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+
+	return &s
+}
+
+func (s *server) put(t *testing.T, name string, v interface{}) {
+	t.Helper()
+
+	data, err := pbjson.Marshal(v)
+	if err != nil {
+		t.Fatalf("pbjson.Marshal(%v): %v", v, err)
+	}
+	fn := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fn, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *server) stats() ([]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...), s.notMod
+}
+
+func TestOpenURL(t *testing.T) {
+	s := newServer(t)
+	s.put(t, "municipalities/ids.json", []int64{70017, 80438})
+	s.put(t, "municipalities/80438.json", &pb.Municipality{Id: 80438, Name: "НОВИ САД"})
+
+	ds := cadrs.OpenURL(s.URL, t.TempDir())
+	m, err := ds.Municipality(80438)
+	if err != nil {
+		t.Fatalf("Municipality(80438): %v", err)
+	}
+	if m.Name != "НОВИ САД" {
+		t.Errorf("Municipality(80438).Name = %q, want %q", m.Name, "НОВИ САД")
+	}
+
+	// Only the requested file is fetched.
+	if reqs, _ := s.stats(); len(reqs) != 1 || reqs[0] != "/municipalities/80438.json" {
+		t.Errorf("requests = %q, want only /municipalities/80438.json", reqs)
+	}
+
+	if _, err := ds.Municipality(1); !errors.Is(err, cadrs.ErrNotFound) {
+		t.Errorf("Municipality(1) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestHTTPFSRevalidate(t *testing.T) {
+	s := newServer(t)
+	s.put(t, "municipalities/ids.json", []int64{1})
+
+	h := &cadrs.HTTPFS{BaseURL: s.URL, CacheDir: t.TempDir()}
+	if got := readFile(t, h, "municipalities/ids.json"); got != "[1]" {
+		t.Fatalf("first read = %q, want %q", got, "[1]")
+	}
+	if got := readFile(t, h, "municipalities/ids.json"); got != "[1]" {
+		t.Errorf("cached read = %q, want %q", got, "[1]")
+	}
+	if _, notMod := s.stats(); notMod != 1 {
+		t.Errorf("revalidated requests = %d, want 1", notMod)
+	}
+
+	s.put(t, "municipalities/ids.json", []int64{1, 2})
+	if got := readFile(t, h, "municipalities/ids.json"); got != "[1,2]" {
+		t.Errorf("updated read = %q, want %q", got, "[1,2]")
+	}
+}
+
+func TestHTTPFSNotFound(t *testing.T) {
+	s := newServer(t)
+	s.put(t, "municipalities/ids.json", []int64{1})
+
+	cache := t.TempDir()
+	h := &cadrs.HTTPFS{BaseURL: s.URL, CacheDir: cache}
+	readFile(t, h, "municipalities/ids.json")
+
+	if err := os.Remove(filepath.Join(s.dir, "municipalities", "ids.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Open("municipalities/ids.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := os.Stat(filepath.Join(cache, "municipalities", "ids.json")); !os.IsNotExist(err) {
+		t.Errorf("cached copy of a deleted file was kept: %v", err)
+	}
+}
+
+func TestHTTPFSOffline(t *testing.T) {
+	s := newServer(t)
+	s.put(t, "municipalities/ids.json", []int64{1})
+
+	h := &cadrs.HTTPFS{BaseURL: s.URL, CacheDir: t.TempDir()}
+	readFile(t, h, "municipalities/ids.json")
+	s.Close()
+
+	if got := readFile(t, h, "municipalities/ids.json"); got != "[1]" {
+		t.Errorf("offline read = %q, want %q", got, "[1]")
+	}
+	if _, err := h.Open("municipalities/1.json"); err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() of an uncached file error = %v, want a fetch error", err)
+	}
+}
+
+func TestHTTPFSTimeout(t *testing.T) {
+	s := newServer(t)
+	s.put(t, "municipalities/ids.json", []int64{1})
+
+	h := &cadrs.HTTPFS{BaseURL: s.URL, CacheDir: t.TempDir()}
+	readFile(t, h, "municipalities/ids.json")
+
+	// A server that never responds.
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(hung.Close)
+
+	h.BaseURL = hung.URL
+	h.Client = &http.Client{Timeout: 100 * time.Millisecond}
+	if got := readFile(t, h, "municipalities/ids.json"); got != "[1]" {
+		t.Errorf("read after timeout = %q, want %q", got, "[1]")
+	}
+}
+
+func readFile(t *testing.T, fsys fs.FS, name string) string {
+	t.Helper()
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		t.Fatalf("Open(%q): %v", name, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll(%q): %v", name, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,57 @@
+package cadrs
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Live holds a dataset that is replaced whenever its files change.
+// Callers in flight keep using the dataset they got. It is safe for concurrent use.
+type Live struct {
+	open func() *Dataset
+
+	mu sync.RWMutex
+	ds *Dataset
+}
+
+// NewLive opens a dataset using open, which is called again on each reload.
+func NewLive(open func() *Dataset) *Live {
+	return &Live{open: open, ds: open()}
+}
+
+// Dataset returns the current dataset.
+func (l *Live) Dataset() *Dataset {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.ds
+}
+
+// Reload replaces the dataset with a freshly opened one if any of the files it
+// has read changed. It reports whether the dataset was replaced.
+func (l *Live) Reload() (bool, error) {
+	changed, err := l.Dataset().Changed()
+	if err != nil || !changed {
+		return false, err
+	}
+
+	ds := l.open()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ds = ds
+	return true, nil
+}
+
+// Watch calls Reload every interval, logging the outcome. It never returns.
+func (l *Live) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		reloaded, err := l.Reload()
+		if err != nil {
+			log.Printf("failed to check the dataset for changes: %v", err)
+		} else if reloaded {
+			log.Print("reloaded the dataset")
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package cadrs_test
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/attilaolah/cad-rs/cadrs"
+)
+
+func TestLiveReload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"municipalities/ids.json":   {Data: []byte(`[70017]`), ModTime: time.Unix(1, 0)},
+		"municipalities/70017.json": {Data: []byte(`{"id": "70017", "name": "ALEKSANDROVAC"}`)},
+		"municipalities/80438.json": {Data: []byte(`{"id": "80438", "name": "NOVI SAD"}`)},
+	}
+	opened := 0
+	l := cadrs.NewLive(func() *cadrs.Dataset {
+		opened++
+		return cadrs.OpenFS(fsys)
+	})
+
+	ms, err := l.Dataset().Municipalities()
+	if err != nil {
+		t.Fatalf("Municipalities(): %v", err)
+	}
+	if len(ms) != 1 {
+		t.Errorf("Municipalities() = %d, want 1", len(ms))
+	}
+
+	old := l.Dataset()
+	if reloaded, err := l.Reload(); err != nil || reloaded {
+		t.Errorf("Reload() of unchanged files = %t, %v, want false, nil", reloaded, err)
+	}
+	if l.Dataset() != old || opened != 1 {
+		t.Errorf("Reload() of unchanged files replaced the dataset")
+	}
+
+	fsys["municipalities/ids.json"] = &fstest.MapFile{Data: []byte(`[70017,80438]`), ModTime: time.Unix(2, 0)}
+	if reloaded, err := l.Reload(); err != nil || !reloaded {
+		t.Errorf("Reload() of changed files = %t, %v, want true, nil", reloaded, err)
+	}
+	if l.Dataset() == old || opened != 2 {
+		t.Errorf("Reload() of changed files kept the old dataset")
+	}
+	// The old dataset keeps working for callers that still hold it.
+	if ms, err := old.Municipalities(); err != nil || len(ms) != 1 {
+		t.Errorf("old Municipalities() = %d, %v, want 1, nil", len(ms), err)
+	}
+}
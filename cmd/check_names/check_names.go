@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/attilaolah/cad-rs/cadrs"
+	"github.com/attilaolah/cad-rs/text"
+)
+
+var dist = flag.String("dist_dir",
+	filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
+	"Directory (root) containing scraped data.")
+
+// Reports names with mixed scripts or without NFC normalization.
+func main() {
+	flag.Parse()
+
+	ds := cadrs.Open(*dist)
+	ms, err := ds.Municipalities()
+	if err != nil {
+		log.Fatalf("failed to load municipalities: %v", err)
+	}
+
+	n := 0
+	check := func(kind string, id interface{}, name string) {
+		_, as := text.Sanitize(name)
+		for _, a := range as {
+			n++
+			fmt.Printf("ANOMALY: %s %v: %q -> %q (%s)\n", kind, id, a.Word, a.Fixed, a.Reason)
+		}
+	}
+
+	for _, m := range ms {
+		check("municipality", m.Id, m.Name)
+		for _, cm := range m.CadastralMunicipalities() {
+			check("cadastral_municipality", cm.Id, cm.Name)
+		}
+
+		ss, err := m.Settlements()
+		if err != nil {
+			log.Fatalf("failed to load settlements of municipality %d: %v", m.Id, err)
+		}
+		for _, s := range ss {
+			check("settlement", fmt.Sprintf("%d/%s", m.Id, s.Name), s.Name)
+			for _, st := range s.Streets {
+				check("street", st.Id, st.FullName)
+			}
+		}
+	}
+
+	fmt.Printf("FOUND: %d anomalies\n", n)
+}
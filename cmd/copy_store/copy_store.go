@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/attilaolah/cad-rs/storage"
+)
+
+var (
+	from = flag.String("from",
+		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
+		"Store to copy from; empty to only compact the destination.")
+	to = flag.String("to", "",
+		"Store to copy to, e.g. log:<file> for a single-file log.")
+	prefix = flag.String("prefix", "address_search/",
+		"Only copy keys starting with this prefix.")
+	compact = flag.Bool("compact", true,
+		"Compact the destination afterwards, if it is a log file.")
+)
+
+func main() {
+	flag.Parse()
+
+	if *to == "" {
+		log.Fatal("missing -to")
+	}
+	dst, err := storage.Open(*to)
+	if err != nil {
+		log.Fatalf("failed to open %q: %v", *to, err)
+	}
+	defer dst.Close()
+
+	if *from != "" {
+		src, err := storage.Open(*from)
+		if err != nil {
+			log.Fatalf("failed to open %q: %v", *from, err)
+		}
+		defer src.Close()
+
+		n := 0
+		if err := storage.Scan(src, *prefix, func(key string, data []byte) error {
+			n++
+			return dst.Put(key, data)
+		}); err != nil {
+			log.Fatalf("failed to copy keys under %q: %v", *prefix, err)
+		}
+		fmt.Printf("COPIED: %d keys\n", n)
+	}
+
+	if l, ok := dst.(*storage.Log); ok && *compact {
+		n := l.Garbage()
+		if err := l.Compact(); err != nil {
+			log.Fatalf("failed to compact %q: %v", *to, err)
+		}
+		fmt.Printf("COMPACTED: %d records\n", n)
+	}
+}
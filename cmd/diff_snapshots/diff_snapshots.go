@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/attilaolah/cad-rs/snapshot"
+	"github.com/attilaolah/cad-rs/storage"
+)
+
+var (
+	oldSnap = flag.String("old",
+		"git:"+filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist")+"@HEAD",
+		"Old snapshot: a directory, bolt:<file> or git:<repo>@<rev>.")
+	newSnap = flag.String("new",
+		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
+		"New snapshot: a directory, bolt:<file> or git:<repo>@<rev>.")
+	format = flag.String("format", "text", "Output format: text or json.")
+)
+
+func main() {
+	flag.Parse()
+
+	a, err := load(*oldSnap)
+	if err != nil {
+		log.Fatalf("failed to load old snapshot: %v", err)
+	}
+	b, err := load(*newSnap)
+	if err != nil {
+		log.Fatalf("failed to load new snapshot: %v", err)
+	}
+
+	c := snapshot.Diff(a, b)
+
+	switch *format {
+	case "text":
+		err = c.WriteText(os.Stdout)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(c)
+	default:
+		log.Fatalf("unknown format: %q", *format)
+	}
+	if err != nil {
+		log.Fatalf("failed to write changelog: %v", err)
+	}
+}
+
+func load(name string) (*snapshot.Snapshot, error) {
+	s, err := storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	return snapshot.Load(s)
+}
@@ -2,17 +2,17 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
 
+	"github.com/attilaolah/cad-rs/pbjson"
 	pb "github.com/attilaolah/cad-rs/proto"
 	"github.com/attilaolah/cad-rs/scrapers"
+	"github.com/attilaolah/cad-rs/storage"
 )
 
 var (
@@ -21,7 +21,7 @@ var (
 		"JSON file containing municipalities.")
 	dst = flag.String("output_dir",
 		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "captchas"),
-		"Output directory for scraped metadata and images.")
+		"Output directory for scraped metadata and images, or bolt:<file> for a Bolt database.")
 	samples = flag.Int("samples", 2, "Number of samples to download from each captcha.")
 )
 
@@ -50,42 +50,31 @@ func main() {
 		}
 	}()
 
+	st, err := storage.Open(*dst)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	defer st.Close()
+
 	n := 0
-	sdir := filepath.Join(*dst, "samples")
 	cs, errs := scrapers.Scrape4Captchas(ctx, *municipalities, *samples)
 
 	for {
 		select {
 		case c := <-cs:
 			for _, s := range c.Samples {
-				fn := filepath.Join(sdir, fmt.Sprintf("%s.jpg", s.Sha1))
-				f, err := os.Create(fn)
-				if err != nil {
-					log.Printf("error creating sample file: %v", err)
-					continue
-				}
-				if _, err = f.Write(s.Data); err != nil {
-					log.Printf("error writing sample data: %v", err)
-					f.Close()
-					continue
-				}
-				if err = f.Close(); err != nil {
-					log.Printf("error closing sample file: %v", err)
+				if err := st.Put(fmt.Sprintf("samples/%s.jpg", s.Sha1), s.Data); err != nil {
+					log.Printf("error writing sample file: %v", err)
 					continue
 				}
 				// Omit JSON binary image data.
 				s.Data = nil
 			}
 
-			tmp, err := save(c)
-			if err != nil {
+			if err := save(st, c); err != nil {
 				log.Printf("error saving captcha: %v", err)
 				break
 			}
-			if err = rename(tmp); err != nil {
-				log.Printf("error renaming captcha: %v", err)
-				break
-			}
 			n += 1
 			fmt.Printf("\rSAVE: %q [%d]", c.Id, n)
 			os.Stdout.Sync()
@@ -102,38 +91,17 @@ func main() {
 	}
 }
 
-// Save the captcha metadata to a file, returning the filename.
-// The returned filename should be renamed (atomically) to its final name.
-func save(c *pb.Captcha) (string, error) {
-	data, err := json.MarshalIndent(c, "", "  ")
+// Save the captcha metadata.
+func save(st storage.Store, c *pb.Captcha) error {
+	data, err := pbjson.MarshalIndent(c, "", "  ")
 	if err != nil {
-		return "", fmt.Errorf("error encoding %q: %w", c.Id, err)
+		return fmt.Errorf("error encoding %q: %w", c.Id, err)
 	}
 	data = append(data, '\n')
 
-	p := fmt.Sprintf("%s.*.json", c.Id)
-	tmp, err := ioutil.TempFile(*dst, p)
-	if err != nil {
-		return "", fmt.Errorf("error creating file with pattern %q: %w", p, err)
+	if err := st.Put(c.Id, data); err != nil {
+		return fmt.Errorf("error storing %q: %w", c.Id, err)
 	}
 
-	defer func() {
-		cerr := tmp.Close()
-		if err == nil {
-			err = fmt.Errorf("error closing file: %w", cerr)
-		}
-	}()
-
-	if _, err = tmp.Write(data); err != nil {
-		return "", fmt.Errorf("error writing %q: %w", tmp.Name(), err)
-	}
-
-	return tmp.Name(), err
-}
-
-// Rename a temporary file to its final name.
-func rename(tmp string) error {
-	dir := filepath.Dir(tmp)
-	dst := fmt.Sprintf("%s.json", filepath.Base(tmp)[:36])
-	return os.Rename(tmp, filepath.Join(dir, dst))
+	return nil
 }
@@ -2,16 +2,22 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
 	"github.com/attilaolah/cad-rs/scrapers"
+	"github.com/attilaolah/cad-rs/storage"
 )
 
-var dst = flag.String("output_dir",
-	filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
-	"Output directory (root) for scraped data.")
+var (
+	dst = flag.String("output_dir",
+		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
+		"Output directory (root) for scraped data, or bolt:<file> for a Bolt database.")
+	archiveDir = flag.String("archive_dir", "",
+		"Directory for archiving stale data, instead of only deleting it.")
+)
 
 func main() {
 	flag.Parse()
@@ -21,7 +27,25 @@ func main() {
 		log.Fatalf("failed to fetch municipalities: %v", err)
 	}
 
-	if err := scrapers.SaveMunicipalities(ms, *dst); err != nil {
+	s, err := storage.Open(*dst)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	defer s.Close()
+
+	var archive storage.Store
+	if *archiveDir != "" {
+		if archive, err = storage.Open(*archiveDir); err != nil {
+			log.Fatalf("failed to open archive: %v", err)
+		}
+		defer archive.Close()
+	}
+
+	pruned, err := scrapers.SaveMunicipalities(ms, s, archive)
+	if err != nil {
 		log.Fatalf("failed to save municipalities data: %v", err)
 	}
+	for _, key := range pruned {
+		fmt.Printf("PRUNE: %s\n", key)
+	}
 }
@@ -2,12 +2,14 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
 
 	"github.com/attilaolah/cad-rs/scrapers"
+	"github.com/attilaolah/cad-rs/storage"
 )
 
 var (
@@ -15,24 +17,54 @@ var (
 		80438, "Municipality ID to fetch streets for.")
 	dst = flag.String("output_dir",
 		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
-		"Output directory for scraped street data.")
+		"Output directory for scraped street data, or bolt:<file> for a Bolt database.")
 	cache = flag.String("cache_dir",
-		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist", "street_search"),
-		"Output directory for caching temporary scraped street search data.")
+		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
+		"Output directory for caching scraped street search data (under address_search/), or log:<file> for a single-file log.")
+	archiveDir = flag.String("archive_dir", "",
+		"Directory for archiving stale data, instead of only deleting it.")
+	settlementCodes = flag.String("settlement_codes", "",
+		"CSV file of official settlement codes (municipality_id,name,code), used as settlement IDs.")
+	linkOverrides = flag.String("link_overrides", "",
+		"CSV file of manual settlement to cadastral municipality links (see link_settlements).")
+	refreshAge = flag.Duration("refresh_age", 0,
+		"Re-fetch cached street search results older than this, oldest first (0 to never re-fetch).")
 )
 
 func main() {
 	flag.Parse()
 
+	out, err := storage.Open(*dst)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	defer out.Close()
+
+	c := out
+	if *cache != *dst {
+		if c, err = storage.Open(*cache); err != nil {
+			log.Fatalf("failed to open cache: %v", err)
+		}
+		defer c.Close()
+	}
+
+	var archive storage.Store
+	if *archiveDir != "" {
+		if archive, err = storage.Open(*archiveDir); err != nil {
+			log.Fatalf("failed to open archive: %v", err)
+		}
+		defer archive.Close()
+	}
+
 	m := int64(*mID)
-	ss, errs := scrapers.ScrapeStreets(*cache, m)
+	ss, errs := scrapers.ScrapeStreets(c, m, *refreshAge)
 	wg := sync.WaitGroup{}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for sr := range ss {
-			if err := sr.Save(*cache, int64(*mID)); err != nil {
+			if err := sr.Save(c, m); err != nil {
 				log.Printf("error saving results to cache: %v", err)
 			}
 		}
@@ -50,12 +82,63 @@ func main() {
 		os.Exit(1)
 	}
 
-	set, err := scrapers.MergeStreets(*cache, m)
+	// Refreshed results leave superseded records behind.
+	if l, ok := c.(*storage.Log); ok && l.Garbage() > 0 {
+		if err := l.Compact(); err != nil {
+			log.Fatalf("failed to compact cache: %v", err)
+		}
+	}
+
+	cov, err := scrapers.CoverStreets(c, m)
+	if err != nil {
+		log.Fatalf("error computing street coverage: %v", err)
+	}
+	fmt.Printf("COVERAGE [%d]: %s\n", m, cov)
+
+	mun, err := scrapers.LoadMunicipality(out, m)
+	if err != nil {
+		log.Fatalf("error loading municipality: %v", err)
+	}
+	set, err := scrapers.MergeStreets(c, m, mun.GetName())
 	if err != nil {
 		log.Fatalf("error merging scraped streets: %v", err)
 	}
 
-	if err := scrapers.SaveSettlements(set, *dst, m); err != nil {
+	old, err := scrapers.LoadSettlements(out, m)
+	if err != nil {
+		log.Fatalf("error loading previous streets: %v", err)
+	}
+	changes := scrapers.UpdateStreetHistory(old, set)
+	for _, st := range changes.Added {
+		fmt.Printf("NEW: %d %s\n", st.Id, st.FullName)
+	}
+	for _, r := range changes.Renamed {
+		fmt.Printf("RENAMED: %d %s -> %s\n", r.New.Id, r.Old.FullName, r.New.FullName)
+	}
+	for _, st := range changes.Removed {
+		fmt.Printf("VANISHED: %d %s\n", st.Id, st.FullName)
+	}
+
+	reg := scrapers.NewSettlementRegistry()
+	if *settlementCodes != "" {
+		if err := reg.LoadSettlementCodes(*settlementCodes); err != nil {
+			log.Fatalf("error loading settlement codes: %v", err)
+		}
+	}
+	if *linkOverrides != "" {
+		if reg.LinkOverrides, err = scrapers.LoadLinkOverrides(*linkOverrides); err != nil {
+			log.Fatalf("error loading link overrides: %v", err)
+		}
+	}
+	if err := reg.Register(out, m, set); err != nil {
+		log.Fatalf("error registering settlements: %v", err)
+	}
+
+	pruned, err := scrapers.SaveSettlements(set, out, archive, m)
+	if err != nil {
 		log.Fatalf("error saving scraped streets: %v", err)
 	}
+	for _, key := range pruned {
+		fmt.Printf("PRUNE: %s\n", key)
+	}
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/attilaolah/cad-rs/history"
+	"github.com/attilaolah/cad-rs/pbjson"
+	"github.com/attilaolah/cad-rs/snapshot"
+	"github.com/attilaolah/cad-rs/storage"
+)
+
+var (
+	dir = flag.String("history_dir",
+		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "history"),
+		"History storage: a directory or bolt:<file>.")
+	record = flag.String("record", "",
+		"Snapshot to record: a directory, bolt:<file> or git:<repo>@<rev>.")
+	at = flag.String("at", "",
+		"Observation time (RFC 3339) of the snapshot; defaults to the commit time for git: snapshots, and to now otherwise.")
+
+	kind = flag.String("kind", history.Streets,
+		"Entity kind to query: municipalities, cadastral_municipalities, settlements or streets.")
+	id   = flag.String("id", "", "Entity ID to query.")
+	asOf = flag.String("as_of", "", "Only show the version current at this time (RFC 3339).")
+)
+
+func main() {
+	flag.Parse()
+
+	s, err := storage.Open(*dir)
+	if err != nil {
+		log.Fatalf("failed to open history storage: %v", err)
+	}
+	defer s.Close()
+	h := history.New(s)
+
+	if *record != "" {
+		if err := recordSnapshot(h, *record, *at); err != nil {
+			log.Fatalf("failed to record snapshot: %v", err)
+		}
+		return
+	}
+
+	if *id == "" {
+		log.Fatal("either -record or -id is required")
+	}
+
+	var v interface{}
+	if *asOf != "" {
+		t, err := time.Parse(time.RFC3339, *asOf)
+		if err != nil {
+			log.Fatalf("failed to parse query time: %v", err)
+		}
+		if v, err = h.AsOf(*kind, *id, t); err != nil {
+			log.Fatalf("failed to query history: %v", err)
+		}
+	} else if v, err = h.History(*kind, *id); err != nil {
+		log.Fatalf("failed to query history: %v", err)
+	}
+
+	data, err := pbjson.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatalf("failed to encode history: %v", err)
+	}
+	fmt.Printf("%s\n", data)
+}
+
+func recordSnapshot(h *history.Store, name, at string) error {
+	s, err := storage.Open(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	t, err := observationTime(s, at)
+	if err != nil {
+		return err
+	}
+
+	snap, err := snapshot.Load(s)
+	if err != nil {
+		return err
+	}
+
+	r, err := h.RecordSnapshot(snap, t)
+	if err != nil {
+		return err
+	}
+	for _, ref := range r.OutOfOrder {
+		fmt.Printf("SKIP [%s]: observation out of order\n", ref)
+	}
+	for _, ref := range r.Removed {
+		fmt.Printf("REMOVED: %s\n", ref)
+	}
+	fmt.Printf("RECORDED: %d entities\n", r.Observed)
+	return nil
+}
+
+// Returns the observation time of a snapshot: the given time if any, the
+// commit time for Git revisions, and the current time otherwise.
+func observationTime(s storage.Store, at string) (time.Time, error) {
+	if at != "" {
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse observation time: %w", err)
+		}
+		return t, nil
+	}
+	if g, ok := s.(*storage.Git); ok {
+		return g.Time()
+	}
+	return time.Now(), nil
+}
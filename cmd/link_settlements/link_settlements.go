@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/attilaolah/cad-rs/cadrs"
+	"github.com/attilaolah/cad-rs/scrapers"
+)
+
+var (
+	dist = flag.String("dist_dir",
+		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
+		"Directory (root) containing scraped data.")
+	overrides = flag.String("link_overrides", "",
+		"CSV file of manual links, applied on top of the matched ones.")
+	review = flag.String("review_file", "",
+		"CSV file to write links below -min_confidence to, in the link overrides format.")
+	minConfidence = flag.Float64("min_confidence", 1,
+		"Links below this confidence are written to -review_file.")
+)
+
+// Links settlements to cadastral municipalities, reporting the links found.
+func main() {
+	flag.Parse()
+
+	var o *scrapers.LinkOverrides
+	if *overrides != "" {
+		var err error
+		if o, err = scrapers.LoadLinkOverrides(*overrides); err != nil {
+			log.Fatalf("failed to load link overrides: %v", err)
+		}
+	}
+
+	var w *csv.Writer
+	if *review != "" {
+		f, err := os.Create(*review)
+		if err != nil {
+			log.Fatalf("failed to create review file: %v", err)
+		}
+		defer f.Close()
+		w = csv.NewWriter(f)
+		w.Write([]string{"municipality_id", "settlement_id", "cadastral_municipality_id", "link", "settlement", "cadastral_municipality", "match", "confidence"})
+	}
+
+	ms, err := cadrs.Open(*dist).Municipalities()
+	if err != nil {
+		log.Fatalf("failed to load municipalities: %v", err)
+	}
+
+	linked, unlinked := 0, 0
+	for _, m := range ms {
+		names := map[int64]string{}
+		for _, cm := range m.Municipality.CadastralMunicipalities {
+			names[cm.Id] = cm.Name
+		}
+
+		ss, err := m.Settlements()
+		if err != nil {
+			log.Fatalf("failed to load settlements of municipality %d: %v", m.Id, err)
+		}
+		for _, set := range ss {
+			links := o.Apply(m.Id, set.Settlement, scrapers.LinkSettlement(set.Settlement, m.Municipality.CadastralMunicipalities))
+			if len(links) == 0 {
+				unlinked++
+				fmt.Printf("UNLINKED [%d]: %s\n", m.Id, set.Name)
+				continue
+			}
+			linked++
+
+			for _, l := range links {
+				fmt.Printf("LINK [%d]: %s -> %s (%d): %s %.2f\n",
+					m.Id, set.Name, names[l.CadastralMunicipalityId], l.CadastralMunicipalityId, l.Match, l.Confidence)
+				if w != nil && l.Confidence < *minConfidence {
+					w.Write([]string{
+						strconv.FormatInt(m.Id, 10), scrapers.SettlementID(set.Settlement), strconv.FormatInt(l.CadastralMunicipalityId, 10), "true",
+						set.Name, names[l.CadastralMunicipalityId], l.Match.String(), strconv.FormatFloat(l.Confidence, 'f', 2, 64),
+					})
+				}
+			}
+		}
+	}
+
+	if w != nil {
+		w.Flush()
+		if err := w.Error(); err != nil {
+			log.Fatalf("failed to write review file: %v", err)
+		}
+	}
+	fmt.Printf("FOUND: %d linked, %d unlinked settlements\n", linked, unlinked)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/attilaolah/cad-rs/atomicfile"
+	"github.com/attilaolah/cad-rs/pbjson"
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/scrapers"
+	"github.com/attilaolah/cad-rs/storage"
+)
+
+var (
+	dist = flag.String("dist_dir",
+		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
+		"Directory (root) containing scraped data.")
+	captchas = flag.String("captchas_dir",
+		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "captchas"),
+		"Directory containing scraped captcha metadata.")
+	dryRun = flag.Bool("dry_run", false, "Only report files that would be rewritten.")
+)
+
+// A decoder decodes a file, returning the value that should be re-encoded.
+type decoder func(data []byte) (interface{}, error)
+
+// A kind describes files matching a (slash-separated) pattern.
+type kind struct {
+	pattern string
+	decode  decoder
+	indent  bool
+}
+
+var (
+	distKinds = []kind{
+		{pattern: "municipalities.json", decode: value[[]scrapers.ScalarMunicipality]()},
+		{pattern: "municipalities+cadastral_municipalities.json", decode: value[[]*pb.Municipality]()},
+		{pattern: "municipalities/ids.json"}, // not a message
+		{pattern: "municipalities/*.json", decode: message[pb.Municipality]()},
+		{pattern: "municipalities/*/cadastral_municipalities.json", decode: value[[]*pb.CadastralMunicipality]()},
+		{pattern: "municipalities/*/cadastral_municipalities/ids.json"}, // not a message
+		{pattern: "municipalities/*/cadastral_municipalities/*.json", decode: message[pb.CadastralMunicipality]()},
+		{pattern: "municipalities/*/settlements+streets.json", decode: value[[]*pb.Settlement]()},
+		{pattern: "municipalities/*/settlements.json", decode: value[[]scrapers.ScalarSettlement]()},
+		{pattern: "municipalities/*/settlements/ids.json"}, // not a message
+		{pattern: "municipalities/*/settlements/*.json", decode: message[pb.Settlement]()},
+		{pattern: "municipalities/*/settlements/*/streets.json", decode: value[[]*pb.Street]()},
+		{pattern: "municipalities/*/settlements/*/streets/ids.json"}, // not a message
+		{pattern: "municipalities/*/settlements/*/streets/*.json", decode: message[pb.Street]()},
+		{pattern: "address_search/*/*.json", decode: value[scrapers.StreetSearchResults]()},
+		{pattern: "street_search/*/*.json", decode: value[scrapers.StreetSearchResults]()}, // legacy location
+	}
+	captchaKinds = []kind{
+		{pattern: "*.json", decode: message[pb.Captcha](), indent: true},
+	}
+)
+
+func main() {
+	flag.Parse()
+
+	n := 0
+	for _, root := range []struct {
+		dir   string
+		kinds []kind
+	}{
+		{*dist, distKinds},
+		{*captchas, captchaKinds},
+	} {
+		m, err := migrate(root.dir, root.kinds)
+		if err != nil {
+			log.Fatalf("failed to migrate %q: %v", root.dir, err)
+		}
+		n += m
+	}
+
+	if err := moveLegacyCache(*dist); err != nil {
+		log.Fatalf("failed to move street search cache in %q: %v", *dist, err)
+	}
+	if err := rekey(*dist); err != nil {
+		log.Fatalf("failed to re-key street search cache in %q: %v", *dist, err)
+	}
+
+	fmt.Printf("MIGRATED: %d files\n", n)
+}
+
+// Moves street search results from the legacy cache directory, which used to be
+// the default -cache_dir of fetch_streets, to address_search/.
+// Results already present under address_search/ are kept.
+func moveLegacyCache(dir string) error {
+	src, dst := filepath.Join(dir, "street_search"), filepath.Join(dir, "address_search")
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	err := filepath.WalkDir(src, func(fn string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(src, fn)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+		if _, err := os.Stat(target); err == nil {
+			fmt.Printf("SKIP: street_search/%s: already in address_search/\n", filepath.ToSlash(rel))
+			if *dryRun {
+				return nil
+			}
+			return os.Remove(fn)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to stat %q: %w", target, err)
+		}
+
+		fmt.Printf("MOVE: street_search/%s -> address_search/%[1]s\n", filepath.ToSlash(rel))
+		if *dryRun {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory %q: %w", filepath.Dir(target), err)
+		}
+		if err := os.Rename(fn, target); err != nil {
+			return fmt.Errorf("failed to move %q to %q: %w", fn, target, err)
+		}
+		return nil
+	})
+	if err != nil || *dryRun {
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
+
+// Moves street search results to collision-free keys.
+func rekey(dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	b, err := storage.NewBatch(storage.NewFS(dir, ".json"), "address_search/")
+	if err != nil {
+		return err
+	}
+	defer b.Close() // discards changes unless committed
+
+	moved, deleted, err := scrapers.RekeyStreetSearchCache(b)
+	if err != nil {
+		return err
+	}
+
+	for _, old := range sortedKeys(moved) {
+		fmt.Printf("REKEY: %s -> %s\n", old, moved[old])
+	}
+	for _, key := range deleted {
+		fmt.Printf("REFETCH: %s\n", key)
+	}
+
+	if *dryRun {
+		return nil
+	}
+	return b.Commit()
+}
+
+func sortedKeys(m map[string]string) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Rewrites all known files under dir, returning the number of changed files.
+func migrate(dir string, kinds []kind) (int, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		log.Printf("skipping missing directory %q", dir)
+		return 0, nil
+	}
+
+	n := 0
+	err := filepath.WalkDir(dir, func(fn string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && fn != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir // e.g. uncommitted batches
+		}
+		if d.IsDir() || filepath.Ext(fn) != ".json" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, fn)
+		if err != nil {
+			return err
+		}
+
+		k, ok := match(kinds, filepath.ToSlash(rel))
+		if !ok {
+			log.Printf("skipping unknown file %q", fn)
+			return nil
+		}
+		if k.decode == nil {
+			return nil
+		}
+
+		changed, err := rewrite(fn, k)
+		if err != nil {
+			return err
+		}
+		if changed {
+			n++
+			fmt.Printf("REWRITE: %s\n", rel)
+		}
+		return nil
+	})
+
+	return n, err
+}
+
+func match(kinds []kind, name string) (kind, bool) {
+	for _, k := range kinds {
+		if ok, _ := path.Match(k.pattern, name); ok {
+			return k, true
+		}
+	}
+	return kind{}, false
+}
+
+// Rewrites a single file, reporting whether its contents changed.
+func rewrite(fn string, k kind) (bool, error) {
+	src, err := os.ReadFile(fn)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %q: %w", fn, err)
+	}
+
+	v, err := k.decode(src)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode %q: %w", fn, err)
+	}
+
+	var dst []byte
+	if k.indent {
+		dst, err = pbjson.MarshalIndent(v, "", "  ")
+	} else {
+		dst, err = pbjson.Marshal(v)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to encode %q: %w", fn, err)
+	}
+	dst = append(dst, '\n')
+
+	if bytes.Equal(src, dst) {
+		return false, nil
+	}
+	if *dryRun {
+		return true, nil
+	}
+
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %q: %w", fn, err)
+	}
+	if err := atomicfile.WriteFile(fn, dst, fi.Mode().Perm()); err != nil {
+		return false, fmt.Errorf("failed to write %q: %w", fn, err)
+	}
+
+	return true, nil
+}
+
+// Decodes a single message.
+func message[T any, M interface {
+	*T
+	proto.Message
+}]() decoder {
+	return func(data []byte) (interface{}, error) {
+		m := M(new(T))
+		return m, pbjson.Unmarshal(data, m)
+	}
+}
+
+// Decodes any other value, including slices of messages.
+func value[T any]() decoder {
+	return func(data []byte) (interface{}, error) {
+		var v T
+		return v, pbjson.Unmarshal(data, &v)
+	}
+}
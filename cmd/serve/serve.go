@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/attilaolah/cad-rs/api"
+	"github.com/attilaolah/cad-rs/cadrs"
+)
+
+var (
+	addr = flag.String("addr", ":8080", "Address to listen on.")
+	dist = flag.String("dist_dir",
+		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
+		"Directory (root) containing scraped data.")
+	reload = flag.Duration("reload_interval", 10*time.Second,
+		"How often to check the loaded data files for changes; 0 disables reloading.")
+)
+
+func main() {
+	flag.Parse()
+
+	ds := cadrs.NewLive(func() *cadrs.Dataset { return cadrs.Open(*dist) })
+	srv := api.New(ds)
+	if *reload > 0 {
+		go ds.Watch(*reload)
+	}
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, srv))
+}
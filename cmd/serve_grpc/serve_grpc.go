@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/attilaolah/cad-rs/cadrs"
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/service"
+)
+
+var (
+	addr = flag.String("addr", ":9090", "Address to listen on.")
+	dist = flag.String("dist_dir",
+		filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "dist"),
+		"Directory (root) containing scraped data.")
+	reload = flag.Duration("reload_interval", 10*time.Second,
+		"How often to check the loaded data files for changes; 0 disables reloading.")
+)
+
+func main() {
+	flag.Parse()
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", *addr, err)
+	}
+
+	ds := cadrs.NewLive(func() *cadrs.Dataset { return cadrs.Open(*dist) })
+	svc := service.New(ds)
+	if *reload > 0 {
+		go ds.Watch(*reload)
+	}
+
+	srv := grpc.NewServer()
+	pb.RegisterCadastreServiceServer(srv, svc)
+	reflection.Register(srv)
+
+	log.Printf("listening on %s", lis.Addr())
+	log.Fatal(srv.Serve(lis))
+}
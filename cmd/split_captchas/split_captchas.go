@@ -10,16 +10,23 @@ import (
 	"path/filepath"
 
 	"github.com/attilaolah/cad-rs/labeller"
+	"github.com/attilaolah/cad-rs/storage"
 )
 
 var datadir = flag.String("data_dir",
 	filepath.Join(os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "data", "captchas"),
-	"Directory containing gaptcha files.")
+	"Directory containing gaptcha files, or bolt:<file> for a Bolt database.")
 
 func main() {
 	flag.Parse()
 
-	imgs, errs := labeller.Split4Captchas(*datadir)
+	s, err := storage.Open(*datadir)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	defer s.Close()
+
+	imgs, errs := labeller.Split4Captchas(s)
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		var img image.Image
@@ -5,6 +5,10 @@ go 1.20
 require (
 	github.com/gocolly/colly v1.2.0
 	github.com/google/uuid v1.3.0
+	go.etcd.io/bbolt v1.3.7
+	golang.org/x/sys v0.6.0
+	golang.org/x/text v0.8.0
+	google.golang.org/grpc v1.54.0
 	google.golang.org/protobuf v1.30.0
 )
 
@@ -21,6 +25,6 @@ require (
 	github.com/saintfish/chardet v0.0.0-20230101081208-5e3ef4b5456d // indirect
 	github.com/temoto/robotstxt v1.1.2 // indirect
 	golang.org/x/net v0.8.0 // indirect
-	golang.org/x/text v0.8.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
+	google.golang.org/genproto v0.0.0-20230110181048-76db0878b65f // indirect
 )
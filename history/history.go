@@ -0,0 +1,366 @@
+// Package history records observed versions of scraped entities.
+//
+// Each entity has a list of versions, each of which was observed unchanged
+// between its first-seen and last-seen timestamps. This allows "as of"
+// queries, e.g. to find out when a street was renamed, or when a cadastral
+// municipality switched its cadastre type.
+package history
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/attilaolah/cad-rs/pbjson"
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/scrapers"
+	"github.com/attilaolah/cad-rs/snapshot"
+	"github.com/attilaolah/cad-rs/storage"
+)
+
+// Entity kinds, as used in keys.
+const (
+	Municipalities          = "municipalities"
+	CadastralMunicipalities = "cadastral_municipalities"
+	Settlements             = "settlements"
+	Streets                 = "streets"
+)
+
+// ErrOutOfOrder is returned when recording an observation older than the latest version.
+var ErrOutOfOrder = errors.New("observation out of order")
+
+// Store keeps entity histories in a storage.Store, under "history/".
+type Store struct {
+	s storage.Store
+}
+
+// New returns a history store backed by s.
+func New(s storage.Store) *Store {
+	return &Store{s: s}
+}
+
+// Key of an entity's history, e.g. "history/streets/123".
+func key(kind, id string) string {
+	return fmt.Sprintf("history/%s/%s", kind, id)
+}
+
+// SettlementID returns the ID used for settlements, which are only unique per municipality.
+func SettlementID(mID int64, s *pb.Settlement) string {
+	return fmt.Sprintf("%d/%s", mID, scrapers.SettlementID(s))
+}
+
+// Report summarizes a recorded snapshot.
+type Report struct {
+	// Number of entities observed.
+	Observed int
+	// Entities that disappeared, as "kind/id".
+	Removed []string
+	// Entities that were not recorded because the snapshot is older than their
+	// latest version, as "kind/id".
+	OutOfOrder []string
+}
+
+// RecordSnapshot records all entities in the snapshot as observed at time t.
+//
+// Entities missing from the snapshot have their latest version closed, but only
+// within the snapshot's scope: cadastral municipalities of the municipalities
+// in it, and settlements and streets of the municipalities with streets.
+// Observations older than an entity's latest version are skipped and reported.
+// All histories are loaded at once, and the changed ones written in a single batch.
+func (h *Store) RecordSnapshot(snap *snapshot.Snapshot, t time.Time) (*Report, error) {
+	b, err := storage.NewBatch(h.s, "history/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start batch: %w", err)
+	}
+	defer b.Close()
+
+	hists := map[string]*pb.History{}
+	if err := storage.Scan(b, "history/", func(k string, data []byte) error {
+		hist := pb.History{}
+		if err := pbjson.Unmarshal(data, &hist); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", k, err)
+		}
+		hists[k] = &hist
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to load histories: %w", err)
+	}
+	changed := map[string]bool{}
+
+	r := Report{}
+	seen := map[string]map[string]bool{
+		Municipalities:          {},
+		CadastralMunicipalities: {},
+		Settlements:             {},
+		Streets:                 {},
+	}
+	observe := func(kind, id string, mID int64, e proto.Message) error {
+		seen[kind][id] = true
+		k := key(kind, id)
+		if hists[k] == nil {
+			hists[k] = &pb.History{}
+		}
+		err := record(hists[k], kind, id, mID, e, t)
+		if errors.Is(err, ErrOutOfOrder) {
+			r.OutOfOrder = append(r.OutOfOrder, kind+"/"+id)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		changed[k] = true
+		r.Observed++
+		return nil
+	}
+
+	ms := map[int64]bool{}
+	for _, m := range snap.Municipalities {
+		ms[m.Id] = true
+		if err := observe(Municipalities, fmt.Sprint(m.Id), 0, m); err != nil {
+			return nil, err
+		}
+		for _, cm := range m.CadastralMunicipalities {
+			if err := observe(CadastralMunicipalities, fmt.Sprint(cm.Id), m.Id, cm); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for mID, ss := range snap.Settlements {
+		for _, set := range ss {
+			if err := observe(Settlements, SettlementID(mID, set), mID, set); err != nil {
+				return nil, err
+			}
+			for _, st := range set.Streets {
+				if err := observe(Streets, fmt.Sprint(st.Id), mID, st); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// Whether the snapshot covers an entity of the given kind and municipality.
+	covered := func(kind string, mID int64) bool {
+		switch kind {
+		case Municipalities:
+			return len(ms) > 0
+		case CadastralMunicipalities:
+			return ms[mID]
+		}
+		_, ok := snap.Settlements[mID]
+		return ok
+	}
+	for _, kind := range []string{Municipalities, CadastralMunicipalities, Settlements, Streets} {
+		prefix := key(kind, "")
+		keys := []string{}
+		for k := range hists {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			id := strings.TrimPrefix(k, prefix)
+			if seen[kind][id] {
+				continue
+			}
+			if remove(hists[k], kind, id, t, covered) {
+				changed[k] = true
+				r.Removed = append(r.Removed, kind+"/"+id)
+			}
+		}
+	}
+
+	for k := range changed {
+		if err := put(b, k, hists[k]); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Record records a single observation of an entity at time t.
+// If the entity is unchanged since the latest version, that version is extended.
+func (h *Store) Record(kind, id string, e proto.Message, t time.Time) error {
+	hist, err := h.History(kind, id)
+	if err != nil {
+		return err
+	}
+	if err := record(hist, kind, id, 0, e, t); err != nil {
+		return err
+	}
+	return put(h.s, key(kind, id), hist)
+}
+
+// Records an observation of an entity in municipality mID (0 if unknown) in
+// its history.
+func record(hist *pb.History, kind, id string, mID int64, e proto.Message, t time.Time) error {
+	v, err := newVersion(e)
+	if err != nil {
+		return err
+	}
+
+	if mID != 0 {
+		hist.MunicipalityId = mID
+	}
+
+	if n := len(hist.Versions); n > 0 {
+		last := hist.Versions[n-1]
+		same := proto.Equal(&pb.Version{Entity: last.Entity}, v)
+		reappeared := last.RemovedAt != nil && !t.Before(last.RemovedAt.AsTime())
+		switch {
+		case reappeared:
+			// Start a new version, even if unchanged.
+		case t.Before(last.LastSeen.AsTime()) || last.RemovedAt != nil:
+			if !same {
+				return fmt.Errorf("%w: %s/%s at %s", ErrOutOfOrder, kind, id, t)
+			}
+			if t.Before(last.FirstSeen.AsTime()) {
+				last.FirstSeen = tspb.New(t)
+			}
+			if t.After(last.LastSeen.AsTime()) {
+				last.LastSeen = tspb.New(t)
+			}
+			return nil
+		case same:
+			last.LastSeen = tspb.New(t)
+			return nil
+		}
+	}
+
+	v.FirstSeen = tspb.New(t)
+	v.LastSeen = tspb.New(t)
+	hist.Versions = append(hist.Versions, v)
+	return nil
+}
+
+// Closes the latest version of an entity that was not observed at time t, if
+// covered reports that it should have been. Returns whether it was closed.
+func remove(hist *pb.History, kind, id string, t time.Time, covered func(kind string, mID int64) bool) bool {
+	n := len(hist.Versions)
+	if n == 0 {
+		return false
+	}
+
+	mID := hist.MunicipalityId
+	if mID == 0 && kind == Settlements {
+		// Settlement IDs start with the municipality ID.
+		mID, _ = strconv.ParseInt(id[:strings.IndexByte(id+"/", '/')], 10, 64)
+	}
+	if kind != Municipalities && mID == 0 {
+		return false // unknown scope
+	}
+	if !covered(kind, mID) {
+		return false
+	}
+
+	last := hist.Versions[n-1]
+	if last.RemovedAt != nil || !t.After(last.LastSeen.AsTime()) {
+		return false
+	}
+	last.RemovedAt = tspb.New(t)
+	return true
+}
+
+// History returns all recorded versions of an entity.
+// Entities that were never observed have an empty history.
+func (h *Store) History(kind, id string) (*pb.History, error) {
+	hist := pb.History{}
+
+	data, err := h.s.Get(key(kind, id))
+	if errors.Is(err, storage.ErrNotFound) {
+		return &hist, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load history of %s/%s: %w", kind, id, err)
+	}
+
+	if err := pbjson.Unmarshal(data, &hist); err != nil {
+		return nil, fmt.Errorf("failed to decode history of %s/%s: %w", kind, id, err)
+	}
+	return &hist, nil
+}
+
+// AsOf returns the version of an entity that was current at time t, i.e. the
+// latest version first seen no later than t. If t is after the version's
+// last-seen timestamp, the entity may have disappeared since.
+// Returns ErrNotFound if the entity was not yet observed at t, or was known to
+// be gone by then.
+func (h *Store) AsOf(kind, id string, t time.Time) (*pb.Version, error) {
+	hist, err := h.History(kind, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret *pb.Version
+	for _, v := range hist.Versions {
+		if v.FirstSeen.AsTime().After(t) {
+			break
+		}
+		ret = v
+	}
+	if ret == nil || (ret.RemovedAt != nil && !t.Before(ret.RemovedAt.AsTime())) {
+		return nil, fmt.Errorf("%w: %s/%s as of %s", storage.ErrNotFound, kind, id, t)
+	}
+
+	return ret, nil
+}
+
+// Stores a history under key k.
+func put(s storage.Store, k string, hist *pb.History) error {
+	data, err := pbjson.Marshal(hist)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", k, err)
+	}
+	data = append(data, '\n')
+
+	if err := s.Put(k, data); err != nil {
+		return fmt.Errorf("failed to store %s: %w", k, err)
+	}
+	return nil
+}
+
+// Fields that change with every scrape, and are not part of a version.
+var scrapeFields = map[protoreflect.Name]bool{
+	"updated_at": true,
+	"first_seen": true,
+	"last_seen":  true,
+}
+
+// Wraps an entity in a version, without scrape timestamps and without child entities.
+func newVersion(e proto.Message) (*pb.Version, error) {
+	e = proto.Clone(e)
+	r := e.ProtoReflect()
+	fds := []protoreflect.FieldDescriptor{}
+	r.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if scrapeFields[fd.Name()] || (fd.IsList() && fd.Message() != nil) {
+			fds = append(fds, fd)
+		}
+		return true
+	})
+	for _, fd := range fds {
+		r.Clear(fd)
+	}
+
+	switch e := e.(type) {
+	case *pb.Municipality:
+		return &pb.Version{Entity: &pb.Version_Municipality{Municipality: e}}, nil
+	case *pb.CadastralMunicipality:
+		return &pb.Version{Entity: &pb.Version_CadastralMunicipality{CadastralMunicipality: e}}, nil
+	case *pb.Settlement:
+		return &pb.Version{Entity: &pb.Version_Settlement{Settlement: e}}, nil
+	case *pb.Street:
+		return &pb.Version{Entity: &pb.Version_Street{Street: e}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported entity type %T", e)
+}
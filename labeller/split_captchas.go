@@ -1,17 +1,21 @@
 package labeller
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
 	"image"
 	"image/draw"
 	"image/jpeg"
-	"os"
-	"path/filepath"
+	"path"
 
+	"github.com/attilaolah/cad-rs/pbjson"
 	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/storage"
 )
 
+// Captcha metadata keys are UUIDs.
+const captchaKey = "????????-????-????-????-????????????"
+
 // Pre-crop 4-letter captchas, before slicing them up:
 const (
 	crop4t = 5  // crop top
@@ -21,7 +25,7 @@ const (
 )
 
 // Split4Captchas generates single-letter segments from 4-letter captchas.
-func Split4Captchas(datadir string) (ch chan image.Image, errs chan error) {
+func Split4Captchas(s storage.Store) (ch chan image.Image, errs chan error) {
 	ch = make(chan image.Image)
 	errs = make(chan error)
 
@@ -34,55 +38,49 @@ func Split4Captchas(datadir string) (ch chan image.Image, errs chan error) {
 		done()
 	}
 
-	pat := filepath.Join(datadir, "????????-????-????-????-????????????.json")
-	fs, err := filepath.Glob(pat)
+	keys, err := s.List("")
 	if err != nil {
-		go fail(fmt.Errorf("failed to match pattern %q: %w", pat, err))
+		go fail(fmt.Errorf("failed to list captchas: %w", err))
 		return
 	}
 
 	go func() {
 		defer done()
 
-		for _, fn := range fs {
-			f, err := os.Open(fn)
+		for _, key := range keys {
+			if ok, _ := path.Match(captchaKey, key); !ok {
+				continue // not a captcha
+			}
+
+			data, err := s.Get(key)
 			if err != nil {
-				errs <- fmt.Errorf("failed to open %q: %w", fn, err)
+				errs <- fmt.Errorf("failed to load %q: %w", key, err)
 				continue
 			}
-			closef := func() {
-				if err = f.Close(); err != nil {
-					errs <- fmt.Errorf("failed to close %q: %w", f.Name(), err)
-				}
-			}
 
 			c := pb.Captcha{}
-			if err = json.NewDecoder(f).Decode(&c); err != nil {
-				errs <- fmt.Errorf("failed to decode %q: %w", f.Name(), err)
-				closef()
+			if err = pbjson.Unmarshal(data, &c); err != nil {
+				errs <- fmt.Errorf("failed to decode %q: %w", key, err)
 				continue
 			}
-			closef()
 
 			if c.Type != pb.Captcha_ALPHANUM_4 {
 				continue // ignore other types
 			}
 
-			for _, s := range c.Samples {
-				fn = filepath.Join(datadir, "samples", fmt.Sprintf("%s.jpg", s.Sha1))
-				f, err = os.Open(fn)
+			for _, smp := range c.Samples {
+				key = fmt.Sprintf("samples/%s.jpg", smp.Sha1)
+				data, err := s.Get(key)
 				if err != nil {
-					errs <- fmt.Errorf("failed to open %q: %w", fn, err)
+					errs <- fmt.Errorf("failed to load %q: %w", key, err)
 					continue
 				}
 
-				img, err := jpeg.Decode(f)
+				img, err := jpeg.Decode(bytes.NewReader(data))
 				if err != nil {
-					errs <- fmt.Errorf("failed to decode %q: %w", f.Name(), err)
-					closef()
+					errs <- fmt.Errorf("failed to decode %q: %w", key, err)
 					continue
 				}
-				closef()
 
 				for _, part := range cut4(img) {
 					ch <- part
@@ -0,0 +1,143 @@
+// Package pbjson encodes and decodes protobuf messages as canonical JSON.
+//
+// Messages are encoded using protojson, i.e. with the original proto field
+// names, RFC 3339 timestamps and enum value names. For backwards
+// compatibility, decoding also accepts the encoding/json format that was used
+// before switching to protojson.
+package pbjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	marshal   = protojson.MarshalOptions{UseProtoNames: true}
+	unmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+	msgType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+)
+
+// Marshal returns the compact JSON encoding of v.
+// Messages and slices of messages are encoded using protojson.
+// Any other value is encoded using encoding/json.
+func Marshal(v interface{}) ([]byte, error) {
+	data, err := marshalAny(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Protojson output is deliberately unstable; normalise the whitespace.
+	buf := bytes.Buffer{}
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to compact JSON: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// MarshalIndent is like Marshal but applies indent to format the output.
+func MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	data, err := marshalAny(v)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	if err := json.Indent(&buf, data, prefix, indent); err != nil {
+		return nil, fmt.Errorf("failed to indent JSON: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func marshalAny(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return marshal.Marshal(m)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || !rv.Type().Elem().Implements(msgType) {
+		return json.Marshal(v)
+	}
+
+	items := make([]json.RawMessage, rv.Len())
+	for i := range items {
+		data, err := marshal.Marshal(rv.Index(i).Interface().(proto.Message))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode item %d: %w", i, err)
+		}
+		items[i] = data
+	}
+
+	return json.Marshal(items)
+}
+
+// Unmarshal parses the JSON-encoded data and stores the result in v.
+// Messages and pointers to slices of messages are decoded using protojson,
+// falling back to encoding/json for data written in the legacy format.
+// Any other value is decoded using encoding/json.
+func Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return unmarshalMessage(data, m)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Slice {
+		return json.Unmarshal(data, v)
+	}
+	st := rv.Elem().Type()
+	et := st.Elem()
+	if et.Kind() != reflect.Pointer || !et.Implements(msgType) {
+		return json.Unmarshal(data, v)
+	}
+
+	items := []json.RawMessage{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+
+	s := reflect.MakeSlice(st, len(items), len(items))
+	for i, item := range items {
+		m := reflect.New(et.Elem())
+		if err := unmarshalMessage(item, m.Interface().(proto.Message)); err != nil {
+			return fmt.Errorf("failed to decode item %d: %w", i, err)
+		}
+		s.Index(i).Set(m)
+	}
+	rv.Elem().Set(s)
+
+	return nil
+}
+
+// Decode reads all data from r and decodes it using Unmarshal.
+func Decode(r io.Reader, v interface{}) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return Unmarshal(data, v)
+}
+
+func unmarshalMessage(data []byte, m proto.Message) error {
+	err := unmarshal.Unmarshal(data, m)
+	if err == nil {
+		return nil
+	}
+
+	// Legacy format, as written by encoding/json:
+	proto.Reset(m)
+	if json.Unmarshal(data, m) != nil {
+		// Report the protojson error, the legacy format is deprecated.
+		return err
+	}
+
+	return nil
+}
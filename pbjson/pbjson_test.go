@@ -0,0 +1,139 @@
+package pbjson_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/attilaolah/cad-rs/pbjson"
+	pb "github.com/attilaolah/cad-rs/proto"
+)
+
+func municipality() *pb.Municipality {
+	ts := timestamppb.New(time.Date(2023, 3, 27, 12, 30, 15, 500, time.UTC))
+	return &pb.Municipality{
+		// Larger than 2^53, i.e. not exactly representable as a float64.
+		Id:        9007199254740993,
+		Name:      "НОВИ САД",
+		UpdatedAt: ts,
+		CadastralMunicipalities: []*pb.CadastralMunicipality{{
+			Id:           80438,
+			Name:         "НОВИ САД I",
+			CadastreType: pb.CadastralMunicipality_REAL_ESTATE_CADASTRE,
+			UpdatedAt:    ts,
+		}},
+		Settlements: []*pb.Settlement{{
+			Name:      "NOVI SAD",
+			UpdatedAt: ts,
+			Streets: []*pb.Street{{
+				Id:        -1,
+				Name:      "BULEVAR OSLOBOĐENJA",
+				FullName:  "NOVI SAD, BULEVAR OSLOBOĐENJA",
+				UpdatedAt: ts,
+			}},
+		}},
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	data, err := pbjson.Marshal(municipality())
+	if err != nil {
+		t.Fatalf("Marshal(): %v", err)
+	}
+	for _, want := range []string{
+		`"id":"9007199254740993"`,
+		`"updated_at":"2023-03-27T12:30:15.000000500Z"`,
+		`"cadastre_type":"REAL_ESTATE_CADASTRE"`,
+		`"full_name":"NOVI SAD, BULEVAR OSLOBOĐENJA"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Marshal() = %s, want it to contain %s", data, want)
+		}
+	}
+}
+
+func TestUnmarshalLegacy(t *testing.T) {
+	want := municipality()
+
+	legacy, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("json.Marshal(): %v", err)
+	}
+	current, err := pbjson.Marshal(want)
+	if err != nil {
+		t.Fatalf("pbjson.Marshal(): %v", err)
+	}
+
+	for name, data := range map[string][]byte{"legacy": legacy, "protojson": current} {
+		got := &pb.Municipality{}
+		if err := pbjson.Unmarshal(data, got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", name, err)
+			continue
+		}
+		if !proto.Equal(got, want) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestUnmarshalSlice(t *testing.T) {
+	want := []*pb.Street{
+		{Id: 1, Name: "GLAVNA", UpdatedAt: timestamppb.New(time.Unix(1680000000, 0))},
+		{Id: 9007199254740993, Name: "NOVA 5"},
+	}
+
+	legacy, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("json.Marshal(): %v", err)
+	}
+	current, err := pbjson.Marshal(want)
+	if err != nil {
+		t.Fatalf("pbjson.Marshal(): %v", err)
+	}
+
+	for name, data := range map[string][]byte{"legacy": legacy, "protojson": current} {
+		got := []*pb.Street{}
+		if err := pbjson.Unmarshal(data, &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", name, err)
+			continue
+		}
+		if len(got) != len(want) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", name, got, want)
+			continue
+		}
+		for i := range want {
+			if !proto.Equal(got[i], want[i]) {
+				t.Errorf("Unmarshal(%s)[%d] = %v, want %v", name, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	if err := pbjson.Unmarshal([]byte(`{"id":{}}`), &pb.Street{}); err == nil {
+		t.Error("Unmarshal() of an invalid message succeeded")
+	}
+}
+
+// Values other than messages use encoding/json.
+func TestPlainValues(t *testing.T) {
+	data, err := pbjson.Marshal([]int64{70017, 80438})
+	if err != nil {
+		t.Fatalf("Marshal(): %v", err)
+	}
+	if string(data) != "[70017,80438]" {
+		t.Errorf("Marshal() = %s, want [70017,80438]", data)
+	}
+
+	ids := []int64{}
+	if err := pbjson.Unmarshal(data, &ids); err != nil {
+		t.Fatalf("Unmarshal(): %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 70017 || ids[1] != 80438 {
+		t.Errorf("Unmarshal() = %v, want [70017 80438]", ids)
+	}
+}
@@ -0,0 +1,159 @@
+// Package refdata provides reference data bundled with the repository.
+//
+// The administrative hierarchy above municipalities (districts, regions and
+// statistical codes) is not available from the portal. It is kept in
+// administrative_units.csv instead, which records its version in a comment,
+// and joined to scraped municipalities by ID.
+package refdata
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/attilaolah/cad-rs/proto"
+)
+
+//go:embed administrative_units.csv
+var administrativeUnitsCSV []byte
+
+// Administrative unit of a single municipality.
+type unit struct {
+	district   *pb.District
+	region     *pb.Region
+	lau        string
+	parentCity string
+}
+
+// Parsed on first use.
+var (
+	loadOnce sync.Once
+	units    map[int64]*unit
+	all      *pb.AdministrativeUnits
+	loadErr  error
+)
+
+// Columns of the CSV file.
+var header = []string{
+	"municipality_id", "municipality", "district_id", "district",
+	"nuts3", "region_nuts2", "region", "lau", "parent_city",
+}
+
+// AdministrativeUnits returns all regions and districts, with their members.
+func AdministrativeUnits() (*pb.AdministrativeUnits, error) {
+	loadOnce.Do(load)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	return proto.Clone(all).(*pb.AdministrativeUnits), nil
+}
+
+// Annotate sets the administrative hierarchy of a municipality.
+// Returns false if the municipality is not in the reference data.
+func Annotate(m *pb.Municipality) (bool, error) {
+	loadOnce.Do(load)
+	if loadErr != nil {
+		return false, loadErr
+	}
+
+	u, ok := units[m.Id]
+	if !ok {
+		return false, nil
+	}
+	m.District = proto.Clone(u.district).(*pb.District)
+	m.District.MunicipalityIds = nil
+	m.Region = proto.Clone(u.region).(*pb.Region)
+	m.Region.DistrictIds = nil
+	m.Lau = u.lau
+	m.ParentCity = u.parentCity
+	return true, nil
+}
+
+func load() {
+	units, all, loadErr = parseCSV(administrativeUnitsCSV)
+	if loadErr != nil {
+		loadErr = fmt.Errorf("failed to parse administrative units: %w", loadErr)
+	}
+}
+
+func parseCSV(data []byte) (map[int64]*unit, *pb.AdministrativeUnits, error) {
+	all := pb.AdministrativeUnits{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "# version:"); ok {
+			all.Version = strings.TrimSpace(v)
+			break
+		}
+	}
+	if all.Version == "" {
+		return nil, nil, fmt.Errorf("missing version")
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = len(header)
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(header, ",") {
+		return nil, nil, fmt.Errorf("unexpected header, want %q", strings.Join(header, ","))
+	}
+
+	units := map[int64]*unit{}
+	districts := map[int32]*pb.District{}
+	regions := map[string]*pb.Region{}
+	for _, row := range rows[1:] {
+		mID, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse municipality ID %q: %w", row[0], err)
+		}
+		dID, err := strconv.ParseInt(row[2], 10, 32)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse district ID %q: %w", row[2], err)
+		}
+
+		reg, ok := regions[row[5]]
+		if !ok {
+			reg = &pb.Region{NutsCode: row[5], Name: row[6]}
+			regions[row[5]] = reg
+			all.Regions = append(all.Regions, reg)
+		}
+		d, ok := districts[int32(dID)]
+		if !ok {
+			d = &pb.District{Id: int32(dID), Name: row[3], NutsCode: row[4], RegionNutsCode: row[5]}
+			districts[d.Id] = d
+			all.Districts = append(all.Districts, d)
+			reg.DistrictIds = append(reg.DistrictIds, d.Id)
+		} else if d.RegionNutsCode != row[5] {
+			return nil, nil, fmt.Errorf("district %d is in regions %s and %s", d.Id, d.RegionNutsCode, row[5])
+		}
+		d.MunicipalityIds = append(d.MunicipalityIds, mID)
+
+		if _, ok := units[mID]; ok {
+			return nil, nil, fmt.Errorf("duplicate municipality ID %d", mID)
+		}
+		units[mID] = &unit{district: d, region: reg, lau: row[7], parentCity: row[8]}
+	}
+
+	sort.Slice(all.Regions, func(i, j int) bool {
+		return all.Regions[i].NutsCode < all.Regions[j].NutsCode
+	})
+	sort.Slice(all.Districts, func(i, j int) bool {
+		return all.Districts[i].Id < all.Districts[j].Id
+	})
+	for _, reg := range all.Regions {
+		sort.Slice(reg.DistrictIds, func(i, j int) bool { return reg.DistrictIds[i] < reg.DistrictIds[j] })
+	}
+	for _, d := range all.Districts {
+		sort.Slice(d.MunicipalityIds, func(i, j int) bool { return d.MunicipalityIds[i] < d.MunicipalityIds[j] })
+	}
+
+	return units, &all, nil
+}
@@ -3,7 +3,6 @@ package scrapers
 import (
 	"context"
 	"crypto/sha1"
-	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/url"
@@ -16,6 +15,7 @@ import (
 	"github.com/google/uuid"
 	tspb "google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/attilaolah/cad-rs/pbjson"
 	pb "github.com/attilaolah/cad-rs/proto"
 )
 
@@ -61,7 +61,7 @@ func ScrapeCaptchas(ctx context.Context, typ pb.Captcha_Type, municipalities str
 	}
 
 	ms := []*pb.Municipality{}
-	if err := json.NewDecoder(f).Decode(&ms); err != nil {
+	if err := pbjson.Decode(f, &ms); err != nil {
 		f.Close()
 		go fail(fmt.Errorf("failed to decode %q: %w", f.Name(), err))
 		return
@@ -0,0 +1,202 @@
+package scrapers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/text"
+)
+
+const (
+	// Fuzzy matches need at least this similarity (1 - edits / length).
+	minLinkSimilarity = 0.8
+	// Confidence of fuzzy matches, at similarity 1.
+	fuzzyLinkConfidence = 0.75
+)
+
+// Confidence of each (non-fuzzy) match type.
+var linkConfidence = map[pb.Settlement_Link_Match]float64{
+	pb.Settlement_Link_OVERRIDE:       1,
+	pb.Settlement_Link_EXACT:          1,
+	pb.Settlement_Link_NORMALIZED:     0.95,
+	pb.Settlement_Link_TRANSLITERATED: 0.9,
+	pb.Settlement_Link_PARTIAL:        0.8,
+}
+
+// LinkSettlement links a settlement to the cadastral municipalities with a
+// matching name, best matches first.
+//
+// A settlement may be linked to several cadastral municipalities, e.g. "NOVI
+// SAD" to "NOVI SAD I" through "NOVI SAD IV". Fuzzy matches are only used if
+// there are no better ones, and then only the most similar one.
+func LinkSettlement(set *pb.Settlement, cms []*pb.CadastralMunicipality) []*pb.Settlement_Link {
+	links := []*pb.Settlement_Link{}
+	var fuzzy *pb.Settlement_Link
+	for _, cm := range cms {
+		match, conf := linkScore(set.Name, cm.Name)
+		if match == pb.Settlement_Link_UNKNOWN {
+			continue
+		}
+		l := &pb.Settlement_Link{
+			CadastralMunicipalityId: cm.Id,
+			Match:                   match,
+			Confidence:              conf,
+		}
+		if match != pb.Settlement_Link_FUZZY {
+			links = append(links, l)
+		} else if fuzzy == nil || conf > fuzzy.Confidence {
+			fuzzy = l
+		}
+	}
+
+	if len(links) == 0 && fuzzy != nil {
+		links = append(links, fuzzy)
+	}
+	sortLinks(links)
+	return links
+}
+
+// Returns how well a settlement name matches the name of a cadastral municipality.
+func linkScore(set, cm string) (pb.Settlement_Link_Match, float64) {
+	normalize := func(s string) string {
+		return strings.Join(strings.Fields(strings.ToUpper(norm.NFC.String(s))), " ")
+	}
+
+	switch {
+	case set == cm:
+		return pb.Settlement_Link_EXACT, linkConfidence[pb.Settlement_Link_EXACT]
+	case normalize(set) == normalize(cm):
+		return pb.Settlement_Link_NORMALIZED, linkConfidence[pb.Settlement_Link_NORMALIZED]
+	}
+
+	a, b := text.Fold(set), text.Fold(cm)
+	if a == "" || b == "" {
+		return pb.Settlement_Link_UNKNOWN, 0
+	}
+	if a == b {
+		return pb.Settlement_Link_TRANSLITERATED, linkConfidence[pb.Settlement_Link_TRANSLITERATED]
+	}
+	if strings.HasPrefix(a, b+" ") || strings.HasPrefix(b, a+" ") {
+		return pb.Settlement_Link_PARTIAL, linkConfidence[pb.Settlement_Link_PARTIAL]
+	}
+
+	n := len([]rune(a))
+	if m := len([]rune(b)); m > n {
+		n = m
+	}
+	sim := 1 - float64(text.Distance(a, b))/float64(n)
+	if sim < minLinkSimilarity {
+		return pb.Settlement_Link_UNKNOWN, 0
+	}
+	return pb.Settlement_Link_FUZZY, fuzzyLinkConfidence * sim
+}
+
+func sortLinks(links []*pb.Settlement_Link) {
+	sort.SliceStable(links, func(i, j int) bool {
+		if links[i].Confidence != links[j].Confidence {
+			return links[i].Confidence > links[j].Confidence
+		}
+		return links[i].CadastralMunicipalityId < links[j].CadastralMunicipalityId
+	})
+}
+
+// LinkOverrides are manual corrections of settlement links.
+// Overrides either add a link, or remove one found by LinkSettlement.
+// Settlements are identified by their string ID (see SettlementID), since
+// several settlements of a municipality may share a name.
+type LinkOverrides struct {
+	// Whether to link, by municipality ID, settlement string ID and cadastral municipality ID.
+	links map[int64]map[string]map[int64]bool
+}
+
+// LoadLinkOverrides loads link overrides from a CSV file with the columns
+// municipality_id, settlement_id (the string ID), cadastral_municipality_id and
+// link ("true" or "false"), and a header row. Any further columns, e.g.
+// comments, are ignored, so review files written by link_settlements can be
+// edited and used as is.
+func LoadLinkOverrides(fn string) (*LinkOverrides, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", fn, err)
+	}
+	defer f.Close()
+
+	o := LinkOverrides{links: map[int64]map[string]map[int64]bool{}}
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	if _, err := cr.Read(); err != nil {
+		return nil, fmt.Errorf("failed to read header of %q: %w", fn, err)
+	}
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return &o, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read %q: %w", fn, err)
+		}
+		if len(row) < 4 {
+			return nil, fmt.Errorf("too few columns in %q: %q", fn, row)
+		}
+
+		mID, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse municipality ID %q: %w", row[0], err)
+		}
+		cmID, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cadastral municipality ID %q: %w", row[2], err)
+		}
+		link, err := strconv.ParseBool(row[3])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse link %q: %w", row[3], err)
+		}
+
+		set := strings.TrimSpace(row[1])
+		if o.links[mID] == nil {
+			o.links[mID] = map[string]map[int64]bool{}
+		}
+		if o.links[mID][set] == nil {
+			o.links[mID][set] = map[int64]bool{}
+		}
+		o.links[mID][set][cmID] = link
+	}
+}
+
+// Apply applies the overrides for a settlement to its links.
+// The settlement's string ID must already be set, e.g. by SettlementRegistry.
+func (o *LinkOverrides) Apply(mID int64, set *pb.Settlement, links []*pb.Settlement_Link) []*pb.Settlement_Link {
+	if o == nil {
+		return links
+	}
+	overrides := o.links[mID][SettlementID(set)]
+	if len(overrides) == 0 {
+		return links
+	}
+
+	ret := []*pb.Settlement_Link{}
+	for _, l := range links {
+		if _, ok := overrides[l.CadastralMunicipalityId]; !ok {
+			ret = append(ret, l)
+		}
+	}
+	for cmID, link := range overrides {
+		if link {
+			ret = append(ret, &pb.Settlement_Link{
+				CadastralMunicipalityId: cmID,
+				Match:                   pb.Settlement_Link_OVERRIDE,
+				Confidence:              linkConfidence[pb.Settlement_Link_OVERRIDE],
+			})
+		}
+	}
+	sortLinks(ret)
+	return ret
+}
@@ -151,6 +151,7 @@ func ScrapeMunicipalities() ([]*pb.Municipality, error) {
 
 func cleanup(s string) string {
 	s = strings.TrimSpace(s)
+	s, _ = text.Sanitize(s)
 	s = text.ToLatin.Replace(s)
 	s = text.RemoveDigraphs.Replace(s)
 	s = strings.ToUpper(s)
@@ -1,47 +1,86 @@
 package scrapers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"strings"
 
+	"google.golang.org/protobuf/proto"
+
+	"github.com/attilaolah/cad-rs/pbjson"
 	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/refdata"
+	"github.com/attilaolah/cad-rs/storage"
 )
 
-// DirPerm encodes new directory permissions.
-const DirPerm = 0o755
-
 // ScalarMunicipality is a Municipality with only scalar fields.
 // Non-scalar (i.e. message) fields are turned into references (i.e. IDs).
 type ScalarMunicipality struct {
-	pb.Municipality
+	Municipality *pb.Municipality
 
-	CadastralMunicipalities []int64 `json:"cadastral_municipalities"`
+	CadastralMunicipalities []int64
+	Settlements             []string
+	// District ID and region NUTS code, nil if unknown.
+	District *int32
+	Region   *string
 }
 
-// SaveMunicipalities stores municipality data in the expected directory layout.
-func SaveMunicipalities(ms []*pb.Municipality, dir string) error {
-	{
-		data := make([]ScalarMunicipality, len(ms))
-		for i, m := range ms {
-			data[i].Municipality = *m
-			data[i].Municipality.CadastralMunicipalities = nil
-			data[i].CadastralMunicipalities = make([]int64, len(m.CadastralMunicipalities))
-			for j, cm := range m.CadastralMunicipalities {
-				data[i].CadastralMunicipalities[j] = cm.Id
-			}
-		}
+// MarshalJSON encodes the municipality using protojson.
+// Cadastral municipalities and settlements are encoded as lists of IDs,
+// the district and region as their ID and NUTS code.
+func (sm ScalarMunicipality) MarshalJSON() ([]byte, error) {
+	return marshalScalar(sm.Municipality, map[string]interface{}{
+		"cadastral_municipalities": nonNil(sm.CadastralMunicipalities),
+		"settlements":              nonNil(sm.Settlements),
+		"district":                 sm.District,
+		"region":                   sm.Region,
+	})
+}
 
-		// /municipalities.json
-		if err := saveJSON(data, dir, "municipalities"); err != nil {
-			return fmt.Errorf("failed to save municipalities: %w", err)
+// UnmarshalJSON decodes a municipality encoded by MarshalJSON.
+// The legacy encoding/json format is also accepted.
+func (sm *ScalarMunicipality) UnmarshalJSON(data []byte) error {
+	sm.Municipality = &pb.Municipality{}
+	sm.CadastralMunicipalities = nil
+	sm.Settlements = nil
+	sm.District = nil
+	sm.Region = nil
+	return unmarshalScalar(data, sm.Municipality, map[string]interface{}{
+		"cadastral_municipalities": &sm.CadastralMunicipalities,
+		"settlements":              &sm.Settlements,
+		"district":                 &sm.District,
+		"region":                   &sm.Region,
+	})
+}
+
+// SaveMunicipalities stores municipality data in the expected layout.
+// Municipalities are annotated with their administrative hierarchy (see refdata).
+// All keys, including the top-level indexes, are written in a single batch.
+// Settlements saved earlier by SaveSettlements are kept.
+// Stale entries are removed (and archived, if archive is not nil).
+// Returns the keys of all removed entries.
+func SaveMunicipalities(ms []*pb.Municipality, s, archive storage.Store) ([]string, error) {
+	b, err := storage.NewBatch(s, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start batch: %w", err)
+	}
+	defer b.Close()
+
+	if ms, err = withSettlements(b, ms); err != nil {
+		return nil, err
+	}
+	for _, m := range ms {
+		if ok, err := refdata.Annotate(m); err != nil {
+			return nil, err
+		} else if !ok {
+			fmt.Printf("UNKNOWN [%d]: no administrative units for %s\n", m.Id, m.Name)
 		}
 	}
 
-	subms := filepath.Join(dir, "municipalities")
-	if err := os.MkdirAll(subms, DirPerm); err != nil {
-		return fmt.Errorf("failed to create directory %q: %w", subms, err)
+	w := record(b)
+	mids := map[string]bool{}
+	for _, m := range ms {
+		mids[fmt.Sprintf("%d", m.Id)] = true
 	}
 
 	{
@@ -51,30 +90,20 @@ func SaveMunicipalities(ms []*pb.Municipality, dir string) error {
 		}
 
 		// /municipalities/ids.json
-		if err := saveJSON(ids, subms, "ids"); err != nil {
-			return fmt.Errorf("failed to save municipalities/ids: %w", err)
+		if err := putJSON(w, "municipalities/ids", ids); err != nil {
+			return nil, fmt.Errorf("failed to save municipalities/ids: %w", err)
 		}
 	}
 
 	for _, m := range ms {
 		// /municipalities/:id.json
-		if err := saveJSON(m, subms, fmt.Sprintf("%d", m.Id)); err != nil {
-			return fmt.Errorf("failed to save municipalities/%d: %w", m.Id, err)
-		}
-
-		subm := filepath.Join(subms, fmt.Sprintf("%d", m.Id))
-		if err := os.MkdirAll(subm, DirPerm); err != nil {
-			return fmt.Errorf("failed to create directory %q: %w", subm, err)
+		if err := putJSON(w, fmt.Sprintf("municipalities/%d", m.Id), m); err != nil {
+			return nil, fmt.Errorf("failed to save municipalities/%d: %w", m.Id, err)
 		}
 
 		// /municipalities/:id/cadastral_municipalities.json
-		if err := saveJSON(m.CadastralMunicipalities, subm, "cadastral_municipalities"); err != nil {
-			return fmt.Errorf("failed to save municipalities/%d/cadastral_municipalities: %w", m.Id, err)
-		}
-
-		subcm := filepath.Join(subm, "cadastral_municipalities")
-		if err := os.MkdirAll(subcm, DirPerm); err != nil {
-			return fmt.Errorf("failed to create directory %q: %w", subcm, err)
+		if err := putJSON(w, fmt.Sprintf("municipalities/%d/cadastral_municipalities", m.Id), m.CadastralMunicipalities); err != nil {
+			return nil, fmt.Errorf("failed to save municipalities/%d/cadastral_municipalities: %w", m.Id, err)
 		}
 
 		ids := make([]int64, len(m.CadastralMunicipalities))
@@ -83,42 +112,143 @@ func SaveMunicipalities(ms []*pb.Municipality, dir string) error {
 		}
 
 		// /municipalities/:id/cadastral_municipalities/ids.json
-		if err := saveJSON(ids, subcm, "ids"); err != nil {
-			return fmt.Errorf("failed to save municipalities/%d/cadastral_municipalities/ids: %w", m.Id, err)
+		if err := putJSON(w, fmt.Sprintf("municipalities/%d/cadastral_municipalities/ids", m.Id), ids); err != nil {
+			return nil, fmt.Errorf("failed to save municipalities/%d/cadastral_municipalities/ids: %w", m.Id, err)
 		}
 
 		for _, cm := range m.CadastralMunicipalities {
 			// /municipalities/:id/cadastral_municipalities/:id.json
-			if err := saveJSON(cm, subcm, fmt.Sprintf("%d", cm.Id)); err != nil {
-				return fmt.Errorf("failed to save municipalities/%d/cadastral_municipalities/%d: %w", m.Id, cm.Id, err)
+			if err := putJSON(w, fmt.Sprintf("municipalities/%d/cadastral_municipalities/%d", m.Id, cm.Id), cm); err != nil {
+				return nil, fmt.Errorf("failed to save municipalities/%d/cadastral_municipalities/%d: %w", m.Id, cm.Id, err)
+			}
+		}
+	}
+
+	// Municipalities own their cadastral municipalities.
+	// Settlements are owned by SaveSettlements, unless the municipality is gone.
+	pruned, err := prune(b, archive, "municipalities/", func(key string) bool {
+		parts := strings.Split(strings.TrimPrefix(key, "municipalities/"), "/")
+		if !mids[parts[0]] {
+			return true
+		}
+		return len(parts) > 1 && len(parts) <= 3 && parts[1] == "cadastral_municipalities"
+	}, w.written)
+	if err != nil {
+		return nil, err
+	}
+
+	{
+		data := make([]ScalarMunicipality, len(ms))
+		for i, m := range ms {
+			data[i].Municipality = m
+			data[i].CadastralMunicipalities = make([]int64, len(m.CadastralMunicipalities))
+			for j, cm := range m.CadastralMunicipalities {
+				data[i].CadastralMunicipalities[j] = cm.Id
+			}
+			data[i].Settlements = make([]string, len(m.Settlements))
+			for j, set := range m.Settlements {
+				data[i].Settlements[j] = SettlementID(set)
+			}
+			if m.District != nil {
+				data[i].District = &m.District.Id
 			}
+			if m.Region != nil {
+				data[i].Region = &m.Region.NutsCode
+			}
+		}
+
+		// /municipalities.json
+		if err := putJSON(b, "municipalities", data); err != nil {
+			return nil, fmt.Errorf("failed to save municipalities: %w", err)
 		}
 	}
 
 	// //municipalities+cadastral_municipalities.json
-	if err := saveJSON(ms, dir, "municipalities+cadastral_municipalities"); err != nil {
-		return fmt.Errorf("failed to save municipalities+cadastral_municipalities: %w", err)
+	if err := putJSON(b, "municipalities+cadastral_municipalities", ms); err != nil {
+		return nil, fmt.Errorf("failed to save municipalities+cadastral_municipalities: %w", err)
+	}
+
+	// /administrative_units.json
+	units, err := refdata.AdministrativeUnits()
+	if err != nil {
+		return nil, err
+	}
+	if err := putJSON(b, "administrative_units", units); err != nil {
+		return nil, fmt.Errorf("failed to save administrative_units: %w", err)
+	}
+
+	if err := b.Commit(); err != nil {
+		return nil, err
+	}
+
+	return pruned, nil
+}
+
+// Returns municipalities with settlements copied over from the stored ones.
+// Municipalities that already have settlements are returned as-is.
+func withSettlements(s storage.Store, ms []*pb.Municipality) ([]*pb.Municipality, error) {
+	ret := make([]*pb.Municipality, len(ms))
+	for i, m := range ms {
+		ret[i] = m
+		if len(m.Settlements) > 0 {
+			continue
+		}
+
+		old := pb.Municipality{}
+		if err := getJSON(s, fmt.Sprintf("municipalities/%d", m.Id), &old); errors.Is(err, storage.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to load municipalities/%d: %w", m.Id, err)
+		}
+		if len(old.Settlements) > 0 {
+			ret[i] = proto.Clone(m).(*pb.Municipality)
+			ret[i].Settlements = old.Settlements
+		}
+	}
+
+	return ret, nil
+}
+
+// Stores JSON data under key.
+// Protobuf messages (and slices thereof) are encoded using protojson.
+func putJSON(s storage.Store, key string, v interface{}) error {
+	data, err := pbjson.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode data for key %q: %w", key, err)
+	}
+	data = append(data, '\n')
+
+	if err := s.Put(key, data); err != nil {
+		return fmt.Errorf("failed to store key %q: %w", key, err)
 	}
 
 	return nil
 }
 
-// Saves JSON data as dir/fn.json.
-func saveJSON(data interface{}, dir, fn string) error {
-	fn += ".json"
-	f, err := os.Create(filepath.Join(dir, fn))
+// LoadMunicipality loads a municipality saved by SaveMunicipalities.
+// Returns nil if it has not been saved yet.
+func LoadMunicipality(s storage.Store, mID int64) (*pb.Municipality, error) {
+	m := pb.Municipality{}
+	key := fmt.Sprintf("municipalities/%d", mID)
+	if err := getJSON(s, key, &m); errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", key, err)
+	}
+	return &m, nil
+}
+
+// Loads JSON data stored under key.
+// Both protojson and the legacy encoding are accepted for protobuf messages.
+func getJSON(s storage.Store, key string, v interface{}) error {
+	data, err := s.Get(key)
 	if err != nil {
-		return fmt.Errorf("failed to create file %q: %w", fn, err)
+		return err
 	}
-	defer func() {
-		if cerr := f.Close(); cerr != nil && err == nil {
-			err = fmt.Errorf("failed to close file %q: %w", fn, cerr)
-		}
-	}()
 
-	if err = json.NewEncoder(f).Encode(data); err != nil {
-		return fmt.Errorf("failed to encode data to file %q: %w", fn, err)
+	if err := pbjson.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode key %q: %w", key, err)
 	}
 
-	return err
+	return nil
 }
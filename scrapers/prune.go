@@ -0,0 +1,59 @@
+package scrapers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/attilaolah/cad-rs/storage"
+)
+
+// Removes stale keys, i.e. keys under prefix that are owned by a saver but
+// were not written by it. Stale entries are copied to the archive store (if
+// not nil) first, under a timestamped prefix. Returns the removed keys.
+func prune(s, archive storage.Store, prefix string, owned func(key string) bool, written map[string]bool) ([]string, error) {
+	keys, err := s.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys under %q: %w", prefix, err)
+	}
+
+	ts := time.Now().UTC().Format("20060102T150405Z")
+	pruned := []string{}
+	for _, key := range keys {
+		if written[key] || !owned(key) {
+			continue
+		}
+
+		if archive != nil {
+			data, err := s.Get(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load stale key %q: %w", key, err)
+			}
+			if err := archive.Put(ts+"/"+key, data); err != nil {
+				return nil, fmt.Errorf("failed to archive stale key %q: %w", key, err)
+			}
+		}
+
+		if err := s.Delete(key); err != nil {
+			return nil, fmt.Errorf("failed to delete stale key %q: %w", key, err)
+		}
+		pruned = append(pruned, key)
+	}
+
+	return pruned, nil
+}
+
+// Records written keys, so stale ones can be pruned afterwards.
+type recorder struct {
+	storage.Store
+
+	written map[string]bool
+}
+
+func record(s storage.Store) *recorder {
+	return &recorder{Store: s, written: map[string]bool{}}
+}
+
+func (r *recorder) Put(key string, data []byte) error {
+	r.written[key] = true
+	return r.Store.Put(key, data)
+}
@@ -0,0 +1,87 @@
+package scrapers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Tokens for upper-case Azbuka letters. Letters without an ASCII
+	// equivalent use a second letter that is never a token by itself ('x' or
+	// 'y'), so no token is a prefix of another and decoding is unambiguous.
+	queryTokens = map[rune]string{
+		'А': "a", 'Б': "b", 'В': "v", 'Г': "g", 'Д': "d", 'Ђ': "dx",
+		'Е': "e", 'Ж': "zx", 'З': "z", 'И': "i", 'Ј': "j", 'К': "k",
+		'Л': "l", 'Љ': "lx", 'М': "m", 'Н': "n", 'Њ': "nx", 'О': "o",
+		'П': "p", 'Р': "r", 'С': "s", 'Т': "t", 'Ћ': "cx", 'У': "u",
+		'Ф': "f", 'Х': "h", 'Ц': "c", 'Ч': "cy", 'Џ': "dy", 'Ш': "sx",
+	}
+
+	queryRunes = func(m map[rune]string) map[string]rune {
+		ret := map[string]rune{}
+		for k, v := range m {
+			ret[v] = k
+		}
+		return ret
+	}(queryTokens)
+)
+
+// EncodeQuery encodes a street search query as a web-safe file name.
+//
+// The encoding is injective and reversible (see DecodeQuery): Azbuka letters
+// become short lower-case tokens, e.g. "ЧА" becomes "cya"; any other rune is
+// escaped as its hex code point between underscores, e.g. " " becomes "_20_".
+func EncodeQuery(q string) string {
+	b := strings.Builder{}
+	for _, r := range q {
+		if t, ok := queryTokens[r]; ok {
+			b.WriteString(t)
+		} else {
+			fmt.Fprintf(&b, "_%x_", r)
+		}
+	}
+	return b.String()
+}
+
+// DecodeQuery decodes a file name created by EncodeQuery.
+func DecodeQuery(name string) (string, error) {
+	b := strings.Builder{}
+	for i := 0; i < len(name); {
+		if name[i] == '_' {
+			end := strings.IndexByte(name[i+1:], '_')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated escape in %q", name)
+			}
+			cp, err := strconv.ParseUint(name[i+1:i+1+end], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape in %q: %w", name, err)
+			}
+			b.WriteRune(rune(cp))
+			i += end + 2
+			continue
+		}
+
+		if i+1 < len(name) {
+			if r, ok := queryRunes[name[i:i+2]]; ok {
+				b.WriteRune(r)
+				i += 2
+				continue
+			}
+		}
+		r, ok := queryRunes[name[i:i+1]]
+		if !ok {
+			return "", fmt.Errorf("invalid character %q in %q", name[i], name)
+		}
+		b.WriteRune(r)
+		i++
+	}
+
+	s := b.String()
+	if EncodeQuery(s) != name {
+		// E.g. non-canonical escapes such as "_0041_".
+		return "", fmt.Errorf("non-canonical query encoding: %q", name)
+	}
+
+	return s, nil
+}
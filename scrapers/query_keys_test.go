@@ -0,0 +1,110 @@
+package scrapers
+
+import (
+	"regexp"
+	"testing"
+)
+
+// Runes to build test queries from: all Azbuka letters, plus others.
+var testQueryRunes = func() []rune {
+	ret := []rune{' ', '/', '.', '%', '_', '5', 'a', 'A', 'x', 'ч', 'Č', 'ǈ'}
+	for r := range queryTokens {
+		ret = append(ret, r)
+	}
+	return ret
+}()
+
+var validQueryName = regexp.MustCompile(`^[a-z0-9_]*$`)
+
+func TestEncodeQuery(t *testing.T) {
+	for _, c := range []struct {
+		q, want string
+	}{
+		{"", ""},
+		{"ЧА", "cya"},
+		{"ЦА", "ca"},
+		{"ЋА", "cxa"},
+		{"ЂУРЕ ЂАКОВИЋА", "dxure_20_dxakovicxa"},
+		{"ЉУБЕ НЕНАДОВИЋА", "lxube_20_nenadovicxa"},
+		{"1. МАЈА", "_31__2e__20_maja"},
+		{"А/Б", "a_2f_b"},
+		{"100%", "_31__30__30__25_"},
+		// Lower-case and Latin letters are escaped, so they differ from upper-case Cyrillic.
+		{"ча", "_447__430_"},
+		{"Чa", "cy_61_"},
+		{"ČA", "_10c__41_"},
+	} {
+		if got := EncodeQuery(c.q); got != c.want {
+			t.Errorf("EncodeQuery(%q) = %q, want %q", c.q, got, c.want)
+		}
+	}
+}
+
+func TestDecodeQueryInvalid(t *testing.T) {
+	for _, name := range []string{
+		"_31",    // unterminated
+		"_zz_",   // not hex
+		"_",      // unterminated
+		"w",      // not a token
+		"x",      // only valid after another letter
+		"cyx",    // ditto
+		"A",      // upper-case
+		"_0031_", // non-canonical: leading zeros
+		"_2F_",   // non-canonical: upper-case hex
+	} {
+		if got, err := DecodeQuery(name); err == nil {
+			t.Errorf("DecodeQuery(%q) = %q, want an error", name, got)
+		}
+	}
+}
+
+// All queries of up to three runes encode to distinct, web-safe file names
+// that decode back to the query.
+func TestQueryRoundTrip(t *testing.T) {
+	seen := map[string]string{}
+	var check func(q []rune)
+	check = func(q []rune) {
+		s := string(q)
+		name := EncodeQuery(s)
+		if !validQueryName.MatchString(name) {
+			t.Fatalf("EncodeQuery(%q) = %q, want only [a-z0-9_]", s, name)
+		}
+		if other, ok := seen[name]; ok {
+			t.Fatalf("EncodeQuery(%q) = EncodeQuery(%q) = %q", s, other, name)
+		}
+		seen[name] = s
+		if got, err := DecodeQuery(name); err != nil || got != s {
+			t.Fatalf("DecodeQuery(%q) = %q, %v, want %q", name, got, err, s)
+		}
+
+		if len(q) == 3 {
+			return
+		}
+		for _, r := range testQueryRunes {
+			check(append(q, r))
+		}
+	}
+	check(make([]rune, 0, 3))
+}
+
+func TestLegacyQuery(t *testing.T) {
+	for _, c := range []struct {
+		q, want string
+		ok      bool
+	}{
+		{"ЧА", "ЧА", true},
+		{"ČA", "ЧА", true},
+		{"ŠABAC", "ШАБАЦ", true},
+		{"ĐURE ĐAKOVIĆA", "ЂУРЕ ЂАКОВИЋА", true},
+		{"1. MAJA", "1. МАЈА", true},
+		// Each may have been a digraph or two letters.
+		{"LJ", "", false},
+		{"NJEGOŠ", "", false},
+		{"DŽEP", "", false},
+	} {
+		got, ok := legacyQuery(c.q)
+		if got != c.want || ok != c.ok {
+			t.Errorf("legacyQuery(%q) = %q, %t, want %q, %t", c.q, got, ok, c.want, c.ok)
+		}
+	}
+}
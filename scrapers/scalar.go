@@ -0,0 +1,74 @@
+package scrapers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/attilaolah/cad-rs/pbjson"
+)
+
+// Encodes a message using protojson, replacing message fields with references.
+// The refs map contains the references (e.g. ID lists), keyed by field name.
+func marshalScalar(m proto.Message, refs map[string]interface{}) ([]byte, error) {
+	m = proto.Clone(m)
+	r := m.ProtoReflect()
+	for name := range refs {
+		fd := r.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return nil, fmt.Errorf("unknown field %q in %s", name, r.Descriptor().FullName())
+		}
+		r.Clear(fd)
+	}
+
+	data, err := pbjson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for name, v := range refs {
+		if fields[name], err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("failed to encode %q references: %w", name, err)
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// Decodes a message encoded by marshalScalar.
+// The refs map contains pointers to the decoded references, keyed by field name.
+func unmarshalScalar(data []byte, m proto.Message, refs map[string]interface{}) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	for name, v := range refs {
+		if raw, ok := fields[name]; ok {
+			if err := json.Unmarshal(raw, v); err != nil {
+				return fmt.Errorf("failed to decode %q references: %w", name, err)
+			}
+			delete(fields, name)
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return pbjson.Unmarshal(data, m)
+}
+
+// Returns non-nil slices, so they are encoded as empty lists rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
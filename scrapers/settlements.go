@@ -0,0 +1,140 @@
+package scrapers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/storage"
+	"github.com/attilaolah/cad-rs/text"
+)
+
+// SettlementRegistry assigns stable IDs to settlements, and links them to
+// their municipality and cadastral municipalities.
+//
+// The portal only identifies settlements by name, so official settlement codes
+// (matični broj naselja) have to be loaded from elsewhere (see
+// LoadSettlementCodes). Settlements without a known code get a slug of their
+// name as their string ID instead.
+type SettlementRegistry struct {
+	// Manual corrections of links to cadastral municipalities, if any.
+	LinkOverrides *LinkOverrides
+
+	// Official codes, by municipality ID and folded settlement name.
+	// Settlements sharing a name have several codes.
+	codes map[int64]map[string][]int64
+}
+
+// NewSettlementRegistry returns a registry without any official codes.
+func NewSettlementRegistry() *SettlementRegistry {
+	return &SettlementRegistry{codes: map[int64]map[string][]int64{}}
+}
+
+// SetCode adds the official code of a settlement.
+func (r *SettlementRegistry) SetCode(mID int64, name string, code int64) {
+	if r.codes[mID] == nil {
+		r.codes[mID] = map[string][]int64{}
+	}
+	name = text.Fold(name)
+	for _, c := range r.codes[mID][name] {
+		if c == code {
+			return
+		}
+	}
+	r.codes[mID][name] = append(r.codes[mID][name], code)
+}
+
+// LoadSettlementCodes loads official settlement codes from a CSV file with
+// the columns municipality_id, name and code, and a header row.
+func (r *SettlementRegistry) LoadSettlementCodes(fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", fn, err)
+	}
+	defer f.Close()
+
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = 3
+	if _, err := cr.Read(); err != nil {
+		return fmt.Errorf("failed to read header of %q: %w", fn, err)
+	}
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read %q: %w", fn, err)
+		}
+
+		mID, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse municipality ID %q: %w", row[0], err)
+		}
+		code, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse settlement code %q: %w", row[2], err)
+		}
+		r.SetCode(mID, row[1], code)
+	}
+}
+
+// Register sets the IDs and links of the settlements of a municipality.
+// Cadastral municipalities are linked using LinkSettlement.
+//
+// Official codes are only used for names that are not shared, since codes
+// cannot be told apart otherwise. Settlements whose string IDs would collide,
+// e.g. ones sharing a name (see MergeStreets), get the lowest ID of their
+// streets as a suffix, e.g. "novo-selo-4412", which does not depend on the
+// other settlements.
+func (r *SettlementRegistry) Register(s storage.Store, mID int64, ss []*pb.Settlement) error {
+	m, err := LoadMunicipality(s, mID)
+	if err != nil {
+		return err
+	}
+
+	names := map[string]int{}
+	for _, set := range ss {
+		names[text.Fold(set.Name)]++
+	}
+
+	ids := make([]string, len(ss))
+	taken := map[string]int{}
+	for i, set := range ss {
+		name := text.Fold(set.Name)
+
+		set.Id = 0
+		if codes := r.codes[mID][name]; len(codes) == 1 && names[name] == 1 {
+			set.Id = codes[0]
+		}
+		set.MunicipalityId = mID
+
+		ids[i] = slug(set.Name)
+		if set.Id != 0 {
+			ids[i] = strconv.FormatInt(set.Id, 10)
+		}
+		taken[ids[i]]++
+	}
+
+	used := map[string]bool{}
+	for i, set := range ss {
+		id := ids[i]
+		if sID := minStreetID(set); taken[id] > 1 && sID != 0 {
+			id = fmt.Sprintf("%s-%d", id, sID)
+		}
+		// Only settlements without streets are left to collide.
+		set.StringId = id
+		for j := 2; used[set.StringId]; j++ {
+			set.StringId = fmt.Sprintf("%s-%d", id, j)
+		}
+		used[set.StringId] = true
+
+		// Overrides refer to settlements by string ID.
+		set.CadastralMunicipalities = r.LinkOverrides.Apply(mID, set, LinkSettlement(set, m.GetCadastralMunicipalities()))
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package scrapers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/storage"
+)
+
+func testSettlements() []*pb.Settlement {
+	streets := func(ids ...int64) []*pb.Street {
+		ret := []*pb.Street{}
+		for _, id := range ids {
+			ret = append(ret, &pb.Street{Id: id})
+		}
+		return ret
+	}
+	return []*pb.Settlement{
+		{Name: "NOVI SAD", Streets: streets(1, 2)},
+		{Name: "KAĆ", Streets: streets(3)},
+		// Same-named settlements: both have a code, neither is used.
+		{Name: "NOVO SELO", Streets: streets(4500, 4501)},
+		{Name: "NOVO SELO", Streets: streets(4413, 4412)},
+		// Several codes for a single settlement: none is used.
+		{Name: "BAČKA TOPOLA", Streets: streets(7)},
+		// Same-named settlements without streets.
+		{Name: "STARO SELO"},
+		{Name: "STARO SELO"},
+	}
+}
+
+func TestRegister(t *testing.T) {
+	s := storage.NewMem()
+	if err := putJSON(s, "municipalities/80438", &pb.Municipality{
+		Id: 80438,
+		CadastralMunicipalities: []*pb.CadastralMunicipality{
+			{Id: 801046, Name: "NOVI SAD I"},
+			{Id: 801097, Name: "KAĆ"},
+			{Id: 801208, Name: "NOVO SELO"},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := filepath.Join(t.TempDir(), "overrides.csv")
+	if err := os.WriteFile(fn, []byte(
+		"municipality_id,settlement_id,cadastral_municipality_id,link,comment\n"+
+			"80438,novo-selo-4500,801208,false,the other Novo Selo\n"+
+			"80438,kac,801046,true,\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	o, err := LoadLinkOverrides(fn)
+	if err != nil {
+		t.Fatalf("LoadLinkOverrides(): %v", err)
+	}
+
+	r := NewSettlementRegistry()
+	r.LinkOverrides = o
+	r.SetCode(80438, "Нови Сад", 800007)
+	r.SetCode(80438, "NOVI SAD", 800007) // duplicates are ignored
+	r.SetCode(80438, "NOVO SELO", 800015)
+	r.SetCode(80438, "NOVO SELO", 800016)
+	r.SetCode(80438, "BAČKA TOPOLA", 800023)
+	r.SetCode(80438, "BAČKA TOPOLA", 800024)
+	r.SetCode(80441, "KAĆ", 800031) // another municipality
+
+	type want struct {
+		id       int64
+		stringID string
+		links    []int64
+	}
+	wants := []want{
+		{800007, "800007", []int64{801046}},
+		{0, "kac", []int64{801046, 801097}},
+		{0, "novo-selo-4500", []int64{}},
+		{0, "novo-selo-4412", []int64{801208}},
+		{0, "backa-topola", []int64{}},
+		{0, "staro-selo", []int64{}},
+		{0, "staro-selo-2", []int64{}},
+	}
+
+	ss := testSettlements()
+	if err := r.Register(s, 80438, ss); err != nil {
+		t.Fatalf("Register(): %v", err)
+	}
+	for i, set := range ss {
+		got := want{id: set.Id, stringID: set.StringId, links: []int64{}}
+		for _, l := range set.CadastralMunicipalities {
+			got.links = append(got.links, l.CadastralMunicipalityId)
+		}
+		if !reflect.DeepEqual(got, wants[i]) {
+			t.Errorf("Register() %d: %q = %+v, want %+v", i, set.Name, got, wants[i])
+		}
+		if set.MunicipalityId != 80438 {
+			t.Errorf("Register() %d: municipality_id = %d, want 80438", i, set.MunicipalityId)
+		}
+	}
+	if l := ss[1].CadastralMunicipalities[0]; l.Match != pb.Settlement_Link_OVERRIDE {
+		t.Errorf("Register(): KAĆ linked to %d by %v, want OVERRIDE", l.CadastralMunicipalityId, l.Match)
+	}
+
+	// Suffixes do not depend on the order of the settlements, or on the others.
+	rev := testSettlements()[2:4]
+	rev[0], rev[1] = rev[1], rev[0]
+	if err := r.Register(s, 80438, rev); err != nil {
+		t.Fatalf("Register(): %v", err)
+	}
+	if rev[0].StringId != "novo-selo-4412" || rev[1].StringId != "novo-selo-4500" {
+		t.Errorf("Register() reversed = %q, %q, want novo-selo-4412, novo-selo-4500", rev[0].StringId, rev[1].StringId)
+	}
+}
@@ -0,0 +1,75 @@
+package scrapers
+
+import (
+	"errors"
+	"fmt"
+
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/storage"
+)
+
+// StreetChanges are the differences between two versions of a municipality's streets.
+type StreetChanges struct {
+	Added   []*pb.Street
+	Removed []*pb.Street
+	// Streets with the same ID but a different full name.
+	Renamed []StreetRename
+}
+
+// StreetRename is a street found under a new name.
+type StreetRename struct {
+	Old, New *pb.Street
+}
+
+// LoadSettlements loads the settlements and streets saved by SaveSettlements.
+// Returns no settlements if none have been saved yet.
+func LoadSettlements(s storage.Store, mID int64) ([]*pb.Settlement, error) {
+	ss := []*pb.Settlement{}
+	key := fmt.Sprintf("municipalities/%d/settlements+streets", mID)
+	if err := getJSON(s, key, &ss); errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", key, err)
+	}
+	return ss, nil
+}
+
+// UpdateStreetHistory compares streets to their previous version.
+// Streets already known keep their earlier first-seen time.
+func UpdateStreetHistory(old, ss []*pb.Settlement) *StreetChanges {
+	prev := map[int64]*pb.Street{}
+	for _, set := range old {
+		for _, st := range set.Streets {
+			prev[st.Id] = st
+		}
+	}
+
+	c := StreetChanges{}
+	for _, set := range ss {
+		for _, st := range set.Streets {
+			o, ok := prev[st.Id]
+			if !ok {
+				c.Added = append(c.Added, st)
+				continue
+			}
+			delete(prev, st.Id)
+
+			if o.FirstSeen != nil && (st.FirstSeen == nil || o.FirstSeen.AsTime().Before(st.FirstSeen.AsTime())) {
+				st.FirstSeen = o.FirstSeen
+			}
+			if o.FullName != st.FullName {
+				c.Renamed = append(c.Renamed, StreetRename{Old: o, New: st})
+			}
+		}
+	}
+
+	for _, set := range old {
+		for _, st := range set.Streets {
+			if _, ok := prev[st.Id]; ok {
+				c.Removed = append(c.Removed, st)
+			}
+		}
+	}
+
+	return &c
+}
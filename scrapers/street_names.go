@@ -0,0 +1,136 @@
+package scrapers
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	pb "github.com/attilaolah/cad-rs/proto"
+)
+
+// StreetName is a street's full name, split into its parts.
+type StreetName struct {
+	// Settlement name, empty if the full name has no settlement part.
+	Settlement string
+	// Name within the settlement.
+	Name string
+
+	Type      pb.Street_Type
+	Honorific string
+	Ordinal   int32
+	Month     int32
+	Core      string
+}
+
+var (
+	// Street types, by their (upper-case Latin) word or abbreviation.
+	streetTypes = map[string]pb.Street_Type{
+		"ULICA":      pb.Street_ULICA,
+		"UL.":        pb.Street_ULICA,
+		"BULEVAR":    pb.Street_BULEVAR,
+		"BUL.":       pb.Street_BULEVAR,
+		"TRG":        pb.Street_TRG,
+		"SOKAK":      pb.Street_SOKAK,
+		"NASELJE":    pb.Street_NASELJE,
+		"NAS.":       pb.Street_NASELJE,
+		"PUT":        pb.Street_PUT,
+		"ŠETALIŠTE":  pb.Street_SETALISTE,
+		"KEJ":        pb.Street_KEJ,
+		"VENAC":      pb.Street_VENAC,
+		"PROLAZ":     pb.Street_PROLAZ,
+		"ŠOR":        pb.Street_SOR,
+		"PARK":       pb.Street_PARK,
+		"SKVER":      pb.Street_SKVER,
+		"OBILAZNICA": pb.Street_OBILAZNICA,
+		"STAZA":      pb.Street_STAZA,
+	}
+
+	// Honorific prefixes, in the genitive as used in street names.
+	honorifics = map[string]bool{
+		"KRALJA": true, "KRALJICE": true, "CARA": true, "CARICE": true,
+		"KNEZA": true, "KNEGINJE": true, "VOJVODE": true, "DESPOTA": true,
+		"ŽUPANA": true, "SVETOG": true, "SVETE": true, "SV.": true,
+		"PATRIJARHA": true, "EPISKOPA": true, "VLADIKE": true, "MITROPOLITA": true,
+		"ĐENERALA": true, "GENERALA": true, "MAJORA": true, "PUKOVNIKA": true,
+		"KAPETANA": true, "DR": true, "DR.": true, "DOKTORA": true,
+		"PROF.": true, "PROFESORA": true, "AKADEMIKA": true, "HADŽI": true,
+		"POPA": true, "NARODNOG": true, "HEROJA": true,
+	}
+
+	// Months, in the genitive as used in dates.
+	months = map[string]int32{
+		"JANUARA": 1, "FEBRUARA": 2, "MARTA": 3, "APRILA": 4, "MAJA": 5, "JUNA": 6,
+		"JULA": 7, "AVGUSTA": 8, "SEPTEMBRA": 9, "OKTOBRA": 10, "NOVEMBRA": 11, "DECEMBRA": 12,
+	}
+
+	// Leading number, e.g. "1. ", "1." or "27 ".
+	ordinal = regexp.MustCompile(`^(\d+)(?:\.\s*|\s+)`)
+)
+
+// ParseStreetName parses a street's full name, as returned by the street
+// search, e.g. "NOVI SAD, BULEVAR OSLOBOĐENJA".
+//
+// The settlement is everything before the first comma, unless that part
+// already looks like a street name; further commas are part of the street
+// name. Names without a comma have no settlement part.
+func ParseStreetName(full string) *StreetName {
+	sn := StreetName{}
+
+	full = strings.Join(strings.Fields(full), " ")
+	if set, name, ok := strings.Cut(full, ","); ok && !isStreetType(firstWord(set)) {
+		sn.Settlement = strings.TrimSpace(set)
+		sn.Name = strings.TrimSpace(name)
+	} else {
+		sn.Name = full
+	}
+
+	words := strings.Fields(sn.Name)
+
+	// Leading or trailing type, e.g. "TRG SLOBODE" or "ŠUMADIJSKI SOKAK".
+	if len(words) > 1 && isStreetType(words[0]) {
+		sn.Type = streetTypes[words[0]]
+		words = words[1:]
+	} else if len(words) > 1 && isStreetType(words[len(words)-1]) {
+		sn.Type = streetTypes[words[len(words)-1]]
+		words = words[:len(words)-1]
+	}
+
+	hs := []string{}
+	for len(words) > 1 && honorifics[words[0]] {
+		hs = append(hs, words[0])
+		words = words[1:]
+	}
+	sn.Honorific = strings.Join(hs, " ")
+
+	sn.Core = strings.Join(words, " ")
+	if m := ordinal.FindStringSubmatch(sn.Core); m != nil && len(m[0]) < len(sn.Core) {
+		if n, err := strconv.ParseInt(m[1], 10, 32); err == nil {
+			sn.Ordinal = int32(n)
+			sn.Core = sn.Core[len(m[0]):]
+			sn.Month = months[firstWord(sn.Core)]
+		}
+	}
+
+	return &sn
+}
+
+// Apply sets the structured name fields of the street.
+func (sn *StreetName) Apply(st *pb.Street) {
+	st.Type = sn.Type
+	st.CoreName = sn.Core
+	st.Honorific = sn.Honorific
+	st.Ordinal = sn.Ordinal
+	st.Month = sn.Month
+}
+
+func isStreetType(word string) bool {
+	_, ok := streetTypes[word]
+	return ok
+}
+
+func firstWord(s string) string {
+	if f := strings.Fields(s); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
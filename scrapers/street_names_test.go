@@ -0,0 +1,46 @@
+package scrapers
+
+import (
+	"testing"
+
+	pb "github.com/attilaolah/cad-rs/proto"
+)
+
+func TestParseStreetName(t *testing.T) {
+	for _, c := range []struct {
+		full string
+		want StreetName
+	}{
+		// Dates, with or without a space after the dot.
+		{"NOVI SAD, 1. MAJA", StreetName{Settlement: "NOVI SAD", Name: "1. MAJA", Ordinal: 1, Month: 5, Core: "MAJA"}},
+		{"NOVI SAD, 1.MAJA", StreetName{Settlement: "NOVI SAD", Name: "1.MAJA", Ordinal: 1, Month: 5, Core: "MAJA"}},
+		{"BEOGRAD, 27. MARTA", StreetName{Settlement: "BEOGRAD", Name: "27. MARTA", Ordinal: 27, Month: 3, Core: "MARTA"}},
+		{"ULICA 27 MARTA", StreetName{Name: "ULICA 27 MARTA", Type: pb.Street_ULICA, Ordinal: 27, Month: 3, Core: "MARTA"}},
+		{"KAĆ, 4. JULA", StreetName{Settlement: "KAĆ", Name: "4. JULA", Ordinal: 4, Month: 7, Core: "JULA"}},
+		{"SUBOTICA, 1. LIGE", StreetName{Settlement: "SUBOTICA", Name: "1. LIGE", Ordinal: 1, Core: "LIGE"}},
+		// Numbers that are not ordinals.
+		{"NOVA 5", StreetName{Name: "NOVA 5", Core: "NOVA 5"}},
+		{"27.", StreetName{Name: "27.", Core: "27."}},
+		// Street types, leading or trailing.
+		{"NOVI SAD, BULEVAR OSLOBOĐENJA", StreetName{Settlement: "NOVI SAD", Name: "BULEVAR OSLOBOĐENJA", Type: pb.Street_BULEVAR, Core: "OSLOBOĐENJA"}},
+		{"ŠUMADIJSKI SOKAK", StreetName{Name: "ŠUMADIJSKI SOKAK", Type: pb.Street_SOKAK, Core: "ŠUMADIJSKI"}},
+		{"TRG", StreetName{Name: "TRG", Core: "TRG"}},
+		// Honorifics.
+		{"KAĆ, KRALJA PETRA I", StreetName{Settlement: "KAĆ", Name: "KRALJA PETRA I", Honorific: "KRALJA", Core: "PETRA I"}},
+		{"SVETOG CARA KONSTANTINA", StreetName{Name: "SVETOG CARA KONSTANTINA", Honorific: "SVETOG CARA", Core: "KONSTANTINA"}},
+		{"BUL. CARA LAZARA", StreetName{Name: "BUL. CARA LAZARA", Type: pb.Street_BULEVAR, Honorific: "CARA", Core: "LAZARA"}},
+		{"KRALJA", StreetName{Name: "KRALJA", Core: "KRALJA"}},
+		// No settlement.
+		{"GLAVNA", StreetName{Name: "GLAVNA", Core: "GLAVNA"}},
+		{"1.MAJA", StreetName{Name: "1.MAJA", Ordinal: 1, Month: 5, Core: "MAJA"}},
+		// Commas after the first are part of the street name; a leading
+		// part that looks like a street is not a settlement.
+		{"BEOGRAD, TRG NIKOLE PAŠIĆA, DEO", StreetName{Settlement: "BEOGRAD", Name: "TRG NIKOLE PAŠIĆA, DEO", Type: pb.Street_TRG, Core: "NIKOLE PAŠIĆA, DEO"}},
+		{"TRG SLOBODE, NOVI SAD", StreetName{Name: "TRG SLOBODE, NOVI SAD", Type: pb.Street_TRG, Core: "SLOBODE, NOVI SAD"}},
+		{"  NOVI   SAD ,  GLAVNA ", StreetName{Settlement: "NOVI SAD", Name: "GLAVNA", Core: "GLAVNA"}},
+	} {
+		if got := ParseStreetName(c.full); *got != c.want {
+			t.Errorf("ParseStreetName(%q) = %+v, want %+v", c.full, *got, c.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package scrapers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/attilaolah/cad-rs/storage"
+	"github.com/attilaolah/cad-rs/text"
+)
+
+const (
+	// Maximum number of results requested per street search query.
+	// Queries returning this many results are assumed to be truncated.
+	streetSearchCount = 1000
+	// Truncated queries are not expanded beyond this length.
+	maxStreetQueryLen = 6
+	// Queries failing for reasons other than truncation are tried this many times.
+	streetSearchAttempts = 3
+	// Delay before retrying a failed query, multiplied by the number of attempts.
+	streetSearchRetryDelay = 10 * time.Second
+)
+
+// Street search query tree.
+//
+// The street search (PretragaUlica) returns streets containing the query, so
+// it is used as an oracle: starting with single letters, only queries with
+// truncated results (or that timed out) are expanded, by prepending or appending
+// another letter. Queries are skipped altogether if one of their substrings
+// had no results (so they can have none either), or had complete results (so
+// all of their results are already known).
+type streetQueries struct {
+	nodes map[string]*streetQuery
+}
+
+type streetQuery struct {
+	truncated bool
+	ids       []int64
+	updatedAt time.Time
+}
+
+func newStreetQueries() *streetQueries {
+	return &streetQueries{nodes: map[string]*streetQuery{}}
+}
+
+// Adds the results of a query to the tree.
+func (sq *streetQueries) add(sr *StreetSearchResults) {
+	n := streetQuery{
+		truncated: sr.Truncated || len(sr.Results) >= streetSearchCount,
+		updatedAt: sr.UpdatedAt,
+	}
+	for _, st := range sr.Results {
+		n.ids = append(n.ids, st.Id)
+	}
+	sq.nodes[sr.Query] = &n
+}
+
+// Returns the queries that still need to be sent, shortest first.
+func (sq *streetQueries) pending() []string {
+	ret := []string{}
+	seen := map[string]bool{}
+	next := []string{}
+	for _, c := range text.Azbuka {
+		next = append(next, string(c))
+	}
+
+	for len(next) > 0 {
+		qs := next
+		next = nil
+		for _, q := range qs {
+			if seen[q] {
+				continue
+			}
+			seen[q] = true
+
+			n, ok := sq.nodes[q]
+			if !ok {
+				if !sq.covered(q) {
+					ret = append(ret, q)
+				}
+				continue
+			}
+			if n.truncated && len([]rune(q)) < maxStreetQueryLen {
+				for _, c := range text.Azbuka {
+					next = append(next, q+string(c), string(c)+q)
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+// Returns the queries with results older than maxAge, oldest first.
+func (sq *streetQueries) stale(maxAge time.Duration) []string {
+	ret := []string{}
+	for q, n := range sq.nodes {
+		if time.Since(n.updatedAt) > maxAge {
+			ret = append(ret, q)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return sq.nodes[ret[i]].updatedAt.Before(sq.nodes[ret[j]].updatedAt)
+	})
+	return ret
+}
+
+// Reports whether the results of q follow from a (proper) substring of q.
+func (sq *streetQueries) covered(q string) bool {
+	rs := []rune(q)
+	for i := range rs {
+		for j := i + 1; j <= len(rs); j++ {
+			if j-i == len(rs) {
+				continue
+			}
+			if n, ok := sq.nodes[string(rs[i:j])]; ok && !n.truncated {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// StreetCoverage summarises how completely the cached street search results
+// cover the streets of a municipality.
+//
+// Every street contains at least one letter, so the search is complete once no
+// query is pending, and every truncated query has been expanded into longer
+// ones. Truncated queries that are too long to be expanded (Unresolved) may hide
+// streets that were not found.
+type StreetCoverage struct {
+	// Number of cached queries.
+	Queries int
+	// Queries not sent yet.
+	Pending int
+	// Truncated queries that are too long to be expanded.
+	Unresolved int
+	// Distinct streets found.
+	Streets int
+}
+
+// Complete reports whether all streets must have been found.
+func (c *StreetCoverage) Complete() bool {
+	return c.Pending == 0 && c.Unresolved == 0
+}
+
+func (c *StreetCoverage) String() string {
+	if c.Complete() {
+		return fmt.Sprintf("%d streets, complete (%d queries)", c.Streets, c.Queries)
+	}
+	return fmt.Sprintf("%d streets, incomplete (%d queries, %d pending, %d unresolved)",
+		c.Streets, c.Queries, c.Pending, c.Unresolved)
+}
+
+// Returns the coverage of the query tree.
+func (sq *streetQueries) coverage() *StreetCoverage {
+	c := StreetCoverage{
+		Queries: len(sq.nodes),
+		Pending: len(sq.pending()),
+	}
+
+	found := map[int64]bool{}
+	for q, n := range sq.nodes {
+		if n.truncated && len([]rune(q)) >= maxStreetQueryLen && !sq.covered(q) {
+			c.Unresolved++
+		}
+		for _, id := range n.ids {
+			found[id] = true
+		}
+	}
+	c.Streets = len(found)
+
+	return &c
+}
+
+// Loads all cached street search results of a municipality.
+func loadStreetQueries(s storage.Store, mID int64) (*streetQueries, error) {
+	sq := newStreetQueries()
+	if err := eachStreetSearch(s, mID, func(r *StreetSearchResults) error {
+		sq.add(r)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to load street search results: %w", err)
+	}
+
+	return sq, nil
+}
+
+// CoverStreets returns the coverage of the cached street search results of a municipality.
+func CoverStreets(s storage.Store, mID int64) (*StreetCoverage, error) {
+	sq, err := loadStreetQueries(s, mID)
+	if err != nil {
+		return nil, err
+	}
+	return sq.coverage(), nil
+}
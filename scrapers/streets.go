@@ -2,30 +2,84 @@ package scrapers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
-	"os"
-	"path/filepath"
+	"net"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gocolly/colly"
 
+	"github.com/attilaolah/cad-rs/pbjson"
 	pb "github.com/attilaolah/cad-rs/proto"
-	"github.com/attilaolah/cad-rs/text"
+	"github.com/attilaolah/cad-rs/storage"
 )
 
 const eKatSearchStreets = eKatURL + "/FindAdresa.aspx/PretragaUlica"
 
+// StreetSearchResults are the results of a single street search query.
 type StreetSearchResults struct {
-	Query     string       `json:"query"`
-	Results   []*pb.Street `json:"results"`
-	UpdatedAt time.Time    `json:"updated_at"`
+	// Query as sent to the server, in upper-case Cyrillic.
+	Query   string
+	Results []*pb.Street
+	// Whether the query failed, e.g. timed out, because it matched too many streets.
+	Truncated bool
+	UpdatedAt time.Time
+}
+
+// JSON representation of StreetSearchResults.
+// Results are encoded separately, using protojson.
+type streetSearchResultsJSON struct {
+	Query     string          `json:"query"`
+	Results   json.RawMessage `json:"results"`
+	Truncated bool            `json:"truncated,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// MarshalJSON encodes the results, using protojson for the streets.
+func (sr StreetSearchResults) MarshalJSON() ([]byte, error) {
+	rs := sr.Results
+	if rs == nil {
+		rs = []*pb.Street{}
+	}
+	data, err := pbjson.Marshal(rs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode results for %q: %w", sr.Query, err)
+	}
+
+	return json.Marshal(streetSearchResultsJSON{
+		Query:     sr.Query,
+		Results:   data,
+		Truncated: sr.Truncated,
+		UpdatedAt: sr.UpdatedAt,
+	})
+}
+
+// UnmarshalJSON decodes the results, accepting both protojson and the legacy encoding.
+func (sr *StreetSearchResults) UnmarshalJSON(data []byte) error {
+	v := streetSearchResultsJSON{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	sr.Query = v.Query
+	sr.Truncated = v.Truncated
+	sr.UpdatedAt = v.UpdatedAt
+	sr.Results = []*pb.Street{}
+	if len(v.Results) == 0 {
+		return nil
+	}
+
+	return pbjson.Unmarshal(v.Results, &sr.Results)
 }
 
 // ScrapeStreets fetches streets for a single municipality.
-func ScrapeStreets(dir string, mID int64) (chan *StreetSearchResults, chan error) {
+// Queries are chosen adaptively (see streetQueries), continuing from the
+// results already in the cache. Cached results older than maxAge are fetched
+// again first, oldest first; a zero maxAge disables refreshing.
+func ScrapeStreets(cache storage.Store, mID int64, maxAge time.Duration) (chan *StreetSearchResults, chan error) {
 	ss := make(chan *StreetSearchResults)
 	errs := make(chan error)
 
@@ -58,11 +112,13 @@ func ScrapeStreets(dir string, mID int64) (chan *StreetSearchResults, chan error
 		ts, err := time.Parse(time.RFC1123, res.Headers.Get("date"))
 		if err != nil {
 			errs <- fmt.Errorf("failed to parse date header: %w", err)
+			<-buf
 			return
 		}
 
 		if ct := strings.ToLower(res.Headers.Get("content-type")); ct != "application/json; charset=utf-8" {
 			errs <- fmt.Errorf("got unexpected response with content-type %q", ct)
+			<-buf
 			return
 		}
 
@@ -71,6 +127,8 @@ func ScrapeStreets(dir string, mID int64) (chan *StreetSearchResults, chan error
 		}{}
 		if err := json.Unmarshal(res.Body, &data); err != nil {
 			errs <- fmt.Errorf("failed to decode response: %w", err)
+			<-buf
+			return
 		}
 
 		sr := <-buf
@@ -102,8 +160,6 @@ func ScrapeStreets(dir string, mID int64) (chan *StreetSearchResults, chan error
 		ss <- sr
 	})
 
-	subdir := filepath.Join(dir, strconv.FormatInt(mID, 10))
-
 	go func() {
 		if err := coll.Limit(&colly.LimitRule{
 			DomainGlob:  "katastar.rgz.gov.rs",
@@ -113,9 +169,15 @@ func ScrapeStreets(dir string, mID int64) (chan *StreetSearchResults, chan error
 			return
 		}
 
-		process := func(q string) bool {
-			buf <- &StreetSearchResults{
-				Query:   cleanup(q),
+		sq, err := loadStreetQueries(cache, mID)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		process := func(q string) *StreetSearchResults {
+			sr := &StreetSearchResults{
+				Query:   q,
 				Results: []*pb.Street{},
 			}
 
@@ -126,59 +188,75 @@ func ScrapeStreets(dir string, mID int64) (chan *StreetSearchResults, chan error
 			}{
 				PrefixText: q,
 				ContextKey: strconv.FormatInt(mID, 10),
-				Count:      1000,
+				Count:      streetSearchCount,
 			})
 			if err != nil {
 				errs <- fmt.Errorf("failed to encode query data: %w", err)
-				return true // unexpected, no need to retry
+				return nil // unexpected, no need to retry
 			}
 
-			fmt.Printf("SCRAPE [%d]: %s:\t", mID, cleanup(q))
-			if err := coll.PostRaw(eKatSearchStreets, data); err != nil {
-				// errs <- fmt.Errorf("failed to fetch page at %q w/ data = %s: %w", eKatSearchStreets, data, err)
-				fmt.Println("SPLIT")
+			for attempt := 1; ; attempt++ {
+				buf <- sr
+				fmt.Printf("SCRAPE [%d]: %s:\t", mID, cleanup(q))
+				err := coll.PostRaw(eKatSearchStreets, data)
+				if err == nil {
+					break
+				}
 				<-buf
 
-				// Retry with smaller chunks:
-				return false
+				if isTruncated(err) {
+					fmt.Println("SPLIT")
+					sr.Truncated = true
+					sr.UpdatedAt = time.Now()
+					return sr
+				}
+				if attempt == streetSearchAttempts {
+					fmt.Println("FAILED")
+					// Not cached, so the query is sent again next time.
+					errs <- fmt.Errorf("failed to search streets for %q: %w", cleanup(q), err)
+					return nil
+				}
+				fmt.Printf("RETRY: %v\n", err)
+				time.Sleep(time.Duration(attempt) * streetSearchRetryDelay)
 			}
 
-			return true
+			if sr.UpdatedAt.IsZero() {
+				return nil // invalid response, already reported
+			}
+			return sr
 		}
 
-		qs := make(chan string)
-		go genStreetSearchQueries(qs, errs, subdir)
-
-		retry := map[string]struct{}{}
-		failed := map[string]bool{}
-		for q := range qs {
-			if !process(q) {
-				// Retry with smaller chunks
-				retry[q] = struct{}{}
-				failed[q] = true
+		if maxAge > 0 {
+			for _, q := range sq.stale(maxAge) {
+				fmt.Printf("REFRESH [%d]: %s\n", mID, cleanup(q))
+				// Failures keep the old results, which are still usable.
+				if sr := process(q); sr != nil && !sr.Truncated {
+					sq.add(sr)
+				}
 			}
 		}
-		for len(retry) > 0 {
-			q := ""
-			for q = range retry {
-				break
-			}
-			delete(retry, q)
 
-			for _, c := range text.Azbuka {
-				for _, q := range []string{string(c) + q, q + string(c)} {
-					if fn := filepath.Join(subdir, fmt.Sprintf("%s.json", asciil(q))); exists(errs, fn) || failed[q] {
-						continue
-					}
-					if !process(q) {
-						// Retry with even smaller chunks (recursively)
-						retry[q] = struct{}{}
-						failed[q] = true
+		// Send queries level by level, since each level's results decide
+		// which longer queries are needed.
+		for qs := sq.pending(); len(qs) > 0; qs = sq.pending() {
+			sent := false
+			for _, q := range qs {
+				if sq.covered(q) {
+					continue // covered by results of this level
+				}
+				if sr := process(q); sr != nil {
+					if sr.Truncated {
+						// Cache the truncation, so that only longer queries are tried again.
+						ss <- sr
 					}
+					sq.add(sr)
+					sent = true
 				}
 			}
+			if !sent {
+				break
+			}
 		}
-
 		coll.Wait()
 		fmt.Println()
 		close(buf)
@@ -188,43 +266,17 @@ func ScrapeStreets(dir string, mID int64) (chan *StreetSearchResults, chan error
 	return ss, errs
 }
 
-func genStreetSearchQueries(qs chan<- string, errs chan<- error, subdir string) {
-	defer close(qs)
-
-	tmp := []string{}
-	for _, a := range text.Azbuka {
-		for _, b := range text.Azbuka {
-			tmp = append(tmp, string([]rune{a, b}))
-		}
+// Reports whether a failed street search most likely matched too many streets.
+// The server then either times out, or fails with an internal error. Other
+// errors, e.g. failed connections, say nothing about the query.
+func isTruncated(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
 	}
-
-	rand.Shuffle(len(tmp), func(i, j int) {
-		tmp[i], tmp[j] = tmp[j], tmp[i]
-	})
-
-	for _, q := range tmp {
-		if fn := filepath.Join(subdir, fmt.Sprintf("%s.json", asciil(q))); !exists(errs, fn) {
-			qs <- q
-		}
-	}
-}
-
-func asciil(s string) string {
-	return strings.ToLower(ascii(s))
-}
-
-func ascii(s string) string {
-	s = text.ToLatin.Replace(s)
-	s = text.RemoveDigraphs.Replace(s)
-	s = text.ToASCII.Replace(s)
-	return s
-}
-
-func exists(errs chan<- error, path string) bool {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return false
-	} else if err != nil {
-		errs <- fmt.Errorf("error checking for file %q: %w", path, err)
+	switch err.Error() {
+	case http.StatusText(http.StatusInternalServerError), http.StatusText(http.StatusGatewayTimeout):
+		return true
 	}
-	return true
+	return false
 }
@@ -1,113 +1,444 @@
 package scrapers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/attilaolah/cad-rs/pbjson"
 	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/storage"
+	"github.com/attilaolah/cad-rs/text"
 )
 
-// Save saves the results to disk.
-func (sr *StreetSearchResults) Save(dir string, mID int64) error {
-	subdir := filepath.Join(dir, strconv.FormatInt(mID, 10))
-	if err := os.MkdirAll(subdir, DirPerm); err != nil {
-		return fmt.Errorf("failed to create directory %q: %w", subdir, err)
-	}
-
-	return saveJSON(sr, subdir, asciil(sr.Query))
+// Save saves the results to the street search cache.
+func (sr *StreetSearchResults) Save(s storage.Store, mID int64) error {
+	return putJSON(s, streetSearchKey(mID, sr.Query), sr)
 }
 
-func MergeStreets(dir string, mID int64) ([]*pb.Settlement, error) {
-	subdir := filepath.Join(dir, strconv.FormatInt(mID, 10))
-	fs, err := ioutil.ReadDir(subdir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list contents of %q: %w", subdir, err)
-	}
+// Key of cached street search results, e.g. "address_search/80438/cya" for "ЧА".
+// See EncodeQuery for details.
+func streetSearchKey(mID int64, q string) string {
+	return streetSearchPrefix(mID) + EncodeQuery(q)
+}
 
-	sm := map[string]*pb.Settlement{}
-	streets := map[string]map[string]time.Time{}
-	ids := map[string]int64{}
+// Key prefix of all cached street search results.
+const streetSearchRoot = "address_search/"
 
-	for _, fi := range fs {
-		fn := filepath.Join(subdir, fi.Name())
-		f, err := os.Open(fn)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open %q: %w", fn, err)
-		}
+// Key prefix of all cached street search results for a municipality.
+func streetSearchPrefix(mID int64) string {
+	return fmt.Sprintf("%s%d/", streetSearchRoot, mID)
+}
 
+// Calls fn with all cached street search results of a municipality.
+func eachStreetSearch(s storage.Store, mID int64, fn func(*StreetSearchResults) error) error {
+	return storage.Scan(s, streetSearchPrefix(mID), func(key string, data []byte) error {
 		r := StreetSearchResults{}
-		err = json.NewDecoder(f).Decode(&r)
-		cerr := f.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode file %q: %w", fn, err)
-		}
-		if cerr != nil {
-			return nil, fmt.Errorf("failed to close file %q: %w", fn, err)
+		if err := pbjson.Unmarshal(data, &r); err != nil {
+			return fmt.Errorf("failed to decode key %q: %w", key, err)
 		}
+		return fn(&r)
+	})
+}
+
+// MergeStreets merges all cached street search results into settlements.
+// Streets are identified by their ID; if the results disagree on a street's
+// name (e.g. because it was renamed between queries), the newest one wins.
+// Streets whose full name has no settlement part are put in the settlement
+// named seat, usually the municipality's name (see LoadMunicipality).
+// Settlements sharing a name are told apart by their streets (see
+// splitSettlement), and sorted by name, then by their lowest street ID.
+func MergeStreets(s storage.Store, mID int64, seat string) ([]*pb.Settlement, error) {
+	type seen struct {
+		*StreetName
+		full              string
+		first, last, name time.Time
+	}
+	streets := map[int64]*seen{}
 
-		for _, s := range r.Results {
-			parts := strings.SplitN(s.FullName, ", ", 2)
-			if len(parts) != 2 {
-				return nil, fmt.Errorf("failed to parse settlement from street full_name %q", s.FullName)
+	if err := eachStreetSearch(s, mID, func(r *StreetSearchResults) error {
+		for _, st := range r.Results {
+			sn := ParseStreetName(st.FullName)
+			if sn.Name == "" {
+				fmt.Printf("SKIP [%d]: empty street full_name %q\n", mID, st.FullName)
+				continue
 			}
-			if _, ok := ids[s.FullName]; !ok {
-				ids[s.FullName] = s.Id
-			} else if ids[s.FullName] != s.Id {
-				return nil, fmt.Errorf("mismatched IDs for street %q: %d vs %d", s.FullName, ids[s.FullName], s.Id)
+			if sn.Settlement == "" {
+				if seat == "" {
+					fmt.Printf("SKIP [%d]: no settlement in street full_name %q\n", mID, st.FullName)
+					continue
+				}
+				sn.Settlement = seat
 			}
 
-			set, str := parts[0], parts[1]
-			if _, ok := sm[set]; !ok {
-				sm[set] = &pb.Settlement{
-					Name:      set,
-					UpdatedAt: timestamppb.New(r.UpdatedAt),
-				}
-				streets[set] = map[string]time.Time{}
-			} else if sm[set].UpdatedAt.AsTime().Before(r.UpdatedAt) {
-				sm[set].UpdatedAt = timestamppb.New(r.UpdatedAt)
+			x, ok := streets[st.Id]
+			if !ok {
+				x = &seen{first: r.UpdatedAt}
+				streets[st.Id] = x
+			}
+			if r.UpdatedAt.Before(x.first) {
+				x.first = r.UpdatedAt
 			}
-			if streets[set][str].Before(r.UpdatedAt) {
-				streets[set][str] = r.UpdatedAt
+			if r.UpdatedAt.After(x.last) {
+				x.last = r.UpdatedAt
 			}
+			if x.StreetName == nil || r.UpdatedAt.After(x.name) {
+				x.StreetName, x.full, x.name = sn, st.FullName, r.UpdatedAt
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to load street search results: %w", err)
+	}
+
+	// Street IDs by settlement name and street name.
+	names := map[string]map[string][]int64{}
+	for id, x := range streets {
+		if names[x.Settlement] == nil {
+			names[x.Settlement] = map[string][]int64{}
 		}
+		names[x.Settlement][x.Name] = append(names[x.Settlement][x.Name], id)
 	}
 
 	ss := []*pb.Settlement{}
-	for _, s := range sm {
-		ss = append(ss, s)
-		for str, t := range streets[s.Name] {
-			s.Streets = append(s.Streets, &pb.Street{
-				Id:        ids[s.Name+", "+str],
-				Name:      str,
-				UpdatedAt: timestamppb.New(t),
+	for name, ids := range names {
+		for _, group := range splitSettlement(ids) {
+			set := &pb.Settlement{Name: name}
+			for _, id := range group {
+				x := streets[id]
+				if set.UpdatedAt == nil || set.UpdatedAt.AsTime().Before(x.last) {
+					set.UpdatedAt = timestamppb.New(x.last)
+				}
+
+				st := &pb.Street{
+					Id:        id,
+					Name:      x.Name,
+					FullName:  x.full,
+					UpdatedAt: timestamppb.New(x.last),
+					FirstSeen: timestamppb.New(x.first),
+					LastSeen:  timestamppb.New(x.last),
+				}
+				x.Apply(st)
+				set.Streets = append(set.Streets, st)
+			}
+			sort.Slice(set.Streets, func(i, j int) bool {
+				return text.AbecedaCollator.Less(set.Streets[i].Name, set.Streets[j].Name)
 			})
+			ss = append(ss, set)
 		}
-		sort.Slice(s.Streets, func(i, j int) bool {
-			return s.Streets[i].Name < s.Streets[j].Name
-		})
 	}
 	sort.Slice(ss, func(i, j int) bool {
-		return ss[i].Name < ss[j].Name
+		if ss[i].Name != ss[j].Name {
+			return text.AbecedaCollator.Less(ss[i].Name, ss[j].Name)
+		}
+		return minStreetID(ss[i]) < minStreetID(ss[j])
 	})
 
 	return ss, nil
 }
 
-func SaveSettlements(ss []*pb.Settlement, dir string, mID int64) error {
-	subdir := filepath.Join(dir, "municipalities", strconv.FormatInt(mID, 10))
+// Splits the streets of a settlement name, given as street IDs by street name,
+// into the settlements sharing that name.
+//
+// Street names are unique within a settlement, so a name with several IDs means
+// as many settlements: its lowest ID goes to the first settlement, the next one
+// to the second, and so on. Other streets go to the settlement with the nearest
+// street ID, since IDs tend to be allocated per settlement. The result only
+// depends on the streets, not on the order they were found in.
+func splitSettlement(names map[string][]int64) [][]int64 {
+	n := 1
+	for _, ids := range names {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		if len(ids) > n {
+			n = len(ids)
+		}
+	}
+
+	groups := make([][]int64, n)
+	rest := []int64{}
+	for _, ids := range names {
+		if len(ids) == 1 {
+			rest = append(rest, ids[0])
+			continue
+		}
+		for i, id := range ids {
+			groups[i] = append(groups[i], id)
+		}
+	}
+	if n == 1 {
+		return [][]int64{rest}
+	}
+
+	// Nearest to the streets known to be in each settlement, ignoring each
+	// other, so that the order of the remaining streets does not matter.
+	known := make([][]int64, n)
+	copy(known, groups)
+	for _, id := range rest {
+		best, dist := 0, int64(-1)
+		for i, ids := range known {
+			for _, other := range ids {
+				d := id - other
+				if d < 0 {
+					d = -d
+				}
+				if dist < 0 || d < dist {
+					best, dist = i, d
+				}
+			}
+		}
+		groups[best] = append(groups[best], id)
+	}
+	return groups
+}
+
+// Returns the lowest ID of a settlement's streets, or 0 if it has none.
+func minStreetID(set *pb.Settlement) int64 {
+	var min int64
+	for _, st := range set.Streets {
+		if min == 0 || st.Id < min {
+			min = st.Id
+		}
+	}
+	return min
+}
+
+// ScalarSettlement is a Settlement with only scalar fields.
+// Streets are turned into references (i.e. IDs).
+type ScalarSettlement struct {
+	Settlement *pb.Settlement
+
+	Streets []int64
+}
+
+// MarshalJSON encodes the settlement using protojson.
+// Streets are encoded as a list of IDs.
+func (ss ScalarSettlement) MarshalJSON() ([]byte, error) {
+	return marshalScalar(ss.Settlement, map[string]interface{}{
+		"streets": nonNil(ss.Streets),
+	})
+}
+
+// UnmarshalJSON decodes a settlement encoded by MarshalJSON.
+func (ss *ScalarSettlement) UnmarshalJSON(data []byte) error {
+	ss.Settlement = &pb.Settlement{}
+	ss.Streets = nil
+	return unmarshalScalar(data, ss.Settlement, map[string]interface{}{
+		"streets": &ss.Streets,
+	})
+}
+
+// SettlementID returns the string ID of a settlement, as used in keys.
+// Settlements not registered yet (see SettlementRegistry) use a slug of their name.
+func SettlementID(s *pb.Settlement) string {
+	if s.StringId != "" {
+		return s.StringId
+	}
+	return slug(s.Name)
+}
+
+// Turns a name into a lower-case ASCII slug, using the official ASCII
+// transliteration, e.g. "BAČKA TOPOLA" becomes "backa-topola".
+func slug(s string) string {
+	b := strings.Builder{}
+	dash := false
+	for _, r := range strings.ToLower(text.OfficialASCII.Replace(s)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// SaveSettlements stores settlement and street data in the expected layout.
+// All keys, i.e. everything under municipalities/:id/settlements/, the indexes
+// next to it and the municipality itself, are written in a single batch.
+// The municipality is updated to include the settlements (without streets).
+// Stale entries are removed (and archived, if archive is not nil).
+// Returns the keys of all removed entries.
+func SaveSettlements(ss []*pb.Settlement, s, archive storage.Store, mID int64) ([]string, error) {
+	prefix := fmt.Sprintf("municipalities/%d/settlements/", mID)
+	b, err := storage.NewBatch(s, "municipalities/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start batch: %w", err)
+	}
+	defer b.Close()
+
+	w := record(b)
+
+	ids := make([]string, len(ss))
+	scalar := make([]ScalarSettlement, len(ss))
+	for i, set := range ss {
+		ids[i] = SettlementID(set)
+		key := prefix + ids[i]
+
+		// /municipalities/:id/settlements/:string_id.json
+		if err := putJSON(w, key, set); err != nil {
+			return nil, fmt.Errorf("failed to save %s: %w", key, err)
+		}
+
+		// /municipalities/:id/settlements/:string_id/streets.json
+		if err := putJSON(w, key+"/streets", nonNil(set.Streets)); err != nil {
+			return nil, fmt.Errorf("failed to save %s/streets: %w", key, err)
+		}
+
+		scalar[i].Settlement = set
+		scalar[i].Streets = make([]int64, len(set.Streets))
+		for j, st := range set.Streets {
+			scalar[i].Streets[j] = st.Id
+
+			// /municipalities/:id/settlements/:string_id/streets/:id.json
+			if err := putJSON(w, fmt.Sprintf("%s/streets/%d", key, st.Id), st); err != nil {
+				return nil, fmt.Errorf("failed to save %s/streets/%d: %w", key, st.Id, err)
+			}
+		}
+
+		// /municipalities/:id/settlements/:string_id/streets/ids.json
+		if err := putJSON(w, key+"/streets/ids", scalar[i].Streets); err != nil {
+			return nil, fmt.Errorf("failed to save %s/streets/ids: %w", key, err)
+		}
+	}
+
+	// /municipalities/:id/settlements/ids.json
+	if err := putJSON(w, prefix+"ids", ids); err != nil {
+		return nil, fmt.Errorf("failed to save %sids: %w", prefix, err)
+	}
+
+	// All keys under the settlements prefix are owned by this saver.
+	pruned, err := prune(b, archive, prefix, func(string) bool { return true }, w.written)
+	if err != nil {
+		return nil, err
+	}
+
+	// /municipalities/:id/settlements.json
+	if err := putJSON(b, fmt.Sprintf("municipalities/%d/settlements", mID), scalar); err != nil {
+		return nil, fmt.Errorf("failed to save municipalities/%d/settlements: %w", mID, err)
+	}
+
 	// //municipalities/:id/settlements+streets.json
-	if err := saveJSON(ss, subdir, "settlements+streets"); err != nil {
-		return fmt.Errorf("failed to save municipalities/%d/settlements+streets: %w", mID, err)
+	if err := putJSON(b, fmt.Sprintf("municipalities/%d/settlements+streets", mID), ss); err != nil {
+		return nil, fmt.Errorf("failed to save municipalities/%d/settlements+streets: %w", mID, err)
+	}
+
+	// /municipalities/:id.json
+	m := pb.Municipality{}
+	key := fmt.Sprintf("municipalities/%d", mID)
+	if err := getJSON(b, key, &m); errors.Is(err, storage.ErrNotFound) {
+		m.Id = mID
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", key, err)
+	}
+	m.Settlements = make([]*pb.Settlement, len(ss))
+	for i, set := range ss {
+		m.Settlements[i] = proto.Clone(set).(*pb.Settlement)
+		m.Settlements[i].Streets = nil
+	}
+	if err := putJSON(b, key, &m); err != nil {
+		return nil, fmt.Errorf("failed to save %s: %w", key, err)
+	}
+
+	if err := b.Commit(); err != nil {
+		return nil, err
+	}
+
+	return pruned, nil
+}
+
+// RekeyStreetSearchCache moves cached street search results stored under
+// legacy keys to the keys returned by EncodeQuery.
+//
+// Legacy keys were not unique: e.g. "ТШ" and "Ч" were both stored as "tsh".
+// Results whose query cannot be recovered unambiguously (e.g. "LJ", which may
+// have been "Љ" or "ЛЈ") are deleted, so that they are fetched again.
+// Returns the moved keys (old to new) and the deleted keys.
+func RekeyStreetSearchCache(s storage.Store) (map[string]string, []string, error) {
+	keys, err := s.List(streetSearchRoot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list keys under %q: %w", streetSearchRoot, err)
+	}
+
+	moved, deleted := map[string]string{}, []string{}
+	for _, key := range keys {
+		dir := key[:strings.LastIndexByte(key, '/')+1]
+		r := StreetSearchResults{}
+		if err := getJSON(s, key, &r); err != nil {
+			return nil, nil, fmt.Errorf("failed to load street search results: %w", err)
+		}
+
+		q, ok := legacyQuery(r.Query)
+		if !ok {
+			if err := s.Delete(key); err != nil {
+				return nil, nil, fmt.Errorf("failed to delete %q: %w", key, err)
+			}
+			deleted = append(deleted, key)
+			continue
+		}
+
+		newKey := dir + EncodeQuery(q)
+		if newKey == key && q == r.Query {
+			continue // up to date
+		}
+		if newKey != key {
+			old := StreetSearchResults{}
+			if err := getJSON(s, newKey, &old); err == nil && old.UpdatedAt.After(r.UpdatedAt) {
+				// Already re-keyed from a fresher copy.
+				if err := s.Delete(key); err != nil {
+					return nil, nil, fmt.Errorf("failed to delete %q: %w", key, err)
+				}
+				deleted = append(deleted, key)
+				continue
+			} else if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return nil, nil, fmt.Errorf("failed to load street search results: %w", err)
+			}
+		}
+
+		r.Query = q
+		if err := putJSON(s, newKey, &r); err != nil {
+			return nil, nil, fmt.Errorf("failed to save %q: %w", newKey, err)
+		}
+		if newKey != key {
+			if err := s.Delete(key); err != nil {
+				return nil, nil, fmt.Errorf("failed to delete %q: %w", key, err)
+			}
+			moved[key] = newKey
+		}
+	}
+
+	return moved, deleted, nil
+}
+
+// Recovers the Cyrillic query from a legacy query, which was stored in
+// upper-case Latin. Reports false if the query is ambiguous.
+func legacyQuery(q string) (string, bool) {
+	cyrillic := true
+	for _, r := range q {
+		if _, ok := queryTokens[r]; !ok {
+			cyrillic = false
+		}
+	}
+	if cyrillic {
+		return q, true
+	}
+
+	for _, pair := range []string{"DŽ", "LJ", "NJ"} {
+		if strings.Contains(q, pair) {
+			return "", false
+		}
+	}
+	ret := text.ToCyrillic.Replace(q)
+	if cleanup(ret) != q {
+		return "", false
 	}
 
-	return nil
+	return ret, true
 }
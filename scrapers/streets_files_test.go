@@ -0,0 +1,120 @@
+package scrapers
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/attilaolah/cad-rs/storage"
+)
+
+func TestRekeyStreetSearchCache(t *testing.T) {
+	older, newer := time.Unix(1680000000, 0).UTC(), time.Unix(1690000000, 0).UTC()
+	s := storage.NewMem()
+	for key, r := range map[string]*StreetSearchResults{
+		// Legacy key and query: moved.
+		"address_search/80438/sha": {Query: "ŠA", UpdatedAt: older},
+		// Legacy query under the current key: query rewritten in place.
+		"address_search/80438/ca": {Query: "CA", UpdatedAt: older},
+		// Ambiguous: deleted.
+		"address_search/80438/lj": {Query: "LJ", UpdatedAt: older},
+		// Up to date.
+		"address_search/80438/nova": {Query: "НОВА", UpdatedAt: older},
+		// Older than the copy already under the new key: deleted.
+		"address_search/80438/cha": {Query: "ČA", UpdatedAt: older},
+		"address_search/80438/cya": {Query: "ЧА", UpdatedAt: newer},
+		// Newer than the copy under the new key: replaces it.
+		"address_search/80497/sha": {Query: "ŠA", UpdatedAt: newer},
+		"address_search/80497/sxa": {Query: "ША", UpdatedAt: older},
+	} {
+		if err := putJSON(s, key, r); err != nil {
+			t.Fatalf("putJSON(%q): %v", key, err)
+		}
+	}
+
+	moved, deleted, err := RekeyStreetSearchCache(s)
+	if err != nil {
+		t.Fatalf("RekeyStreetSearchCache(): %v", err)
+	}
+	if want := map[string]string{
+		"address_search/80438/sha": "address_search/80438/sxa",
+		"address_search/80497/sha": "address_search/80497/sxa",
+	}; !reflect.DeepEqual(moved, want) {
+		t.Errorf("RekeyStreetSearchCache() moved %v, want %v", moved, want)
+	}
+	sort.Strings(deleted)
+	if want := []string{"address_search/80438/cha", "address_search/80438/lj"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("RekeyStreetSearchCache() deleted %v, want %v", deleted, want)
+	}
+
+	want := map[string]*StreetSearchResults{
+		"address_search/80438/ca":   {Query: "ЦА", UpdatedAt: older},
+		"address_search/80438/cya":  {Query: "ЧА", UpdatedAt: newer},
+		"address_search/80438/nova": {Query: "НОВА", UpdatedAt: older},
+		"address_search/80438/sxa":  {Query: "ША", UpdatedAt: older},
+		"address_search/80497/sxa":  {Query: "ША", UpdatedAt: newer},
+	}
+	keys, err := s.List(streetSearchRoot)
+	if err != nil {
+		t.Fatalf("List(): %v", err)
+	}
+	if len(keys) != len(want) {
+		t.Errorf("List() = %v, want %d keys", keys, len(want))
+	}
+	for key, w := range want {
+		got := StreetSearchResults{}
+		if err := getJSON(s, key, &got); err != nil {
+			t.Errorf("getJSON(%q): %v", key, err)
+			continue
+		}
+		if got.Query != w.Query || !got.UpdatedAt.Equal(w.UpdatedAt) {
+			t.Errorf("%q = %q at %v, want %q at %v", key, got.Query, got.UpdatedAt, w.Query, w.UpdatedAt)
+		}
+		if q, err := DecodeQuery(key[len("address_search/80438/"):]); err != nil || q != got.Query {
+			t.Errorf("DecodeQuery(%q) = %q, %v, want %q", key, q, err, got.Query)
+		}
+	}
+
+	// Running it again changes nothing.
+	moved, deleted, err = RekeyStreetSearchCache(s)
+	if err != nil || len(moved) != 0 || len(deleted) != 0 {
+		t.Errorf("RekeyStreetSearchCache() again = %v, %v, %v, want no changes", moved, deleted, err)
+	}
+}
+
+func TestSplitSettlement(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		names map[string][]int64
+		want  [][]int64
+	}{{
+		name:  "unique street names",
+		names: map[string][]int64{"GLAVNA": {5}, "NOVA": {3}},
+		want:  [][]int64{{3, 5}},
+	}, {
+		name:  "two settlements",
+		names: map[string][]int64{"GLAVNA": {100, 5}, "NOVA": {7}, "STARA": {98}, "ŠKOLSKA": {200, 10}},
+		want:  [][]int64{{5, 7, 10}, {98, 100, 200}},
+	}, {
+		name:  "three settlements",
+		names: map[string][]int64{"GLAVNA": {1, 50, 100}, "NOVA": {52}},
+		want:  [][]int64{{1}, {50, 52}, {100}},
+	}, {
+		name:  "names shared by some settlements only",
+		names: map[string][]int64{"GLAVNA": {1, 100}, "NOVA": {2, 101, 200}},
+		want:  [][]int64{{1, 2}, {100, 101}, {200}},
+	}, {
+		name:  "equally near goes to the first",
+		names: map[string][]int64{"GLAVNA": {10, 20}, "NOVA": {15}},
+		want:  [][]int64{{10, 15}, {20}},
+	}} {
+		got := splitSettlement(c.names)
+		for _, ids := range got {
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: splitSettlement() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Package search provides a transliteration-insensitive name index over
+// settlements and streets.
+//
+// Names and queries are folded using text.Fold, so Cyrillic, Gaj's Latin and
+// diacritic-less ASCII spellings all match each other. Queries are matched
+// exactly, by prefix, by (prefixes of) tokens in any order, and optionally
+// within an edit distance of each token.
+package search
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/attilaolah/cad-rs/cadrs"
+	"github.com/attilaolah/cad-rs/text"
+)
+
+// Kind of an indexed document.
+type Kind string
+
+// Kinds of documents.
+const (
+	Settlement Kind = "settlement"
+	Street     Kind = "street"
+)
+
+// Match describes how a document matched the query, best first.
+type Match int
+
+// Match types.
+const (
+	Fuzzy Match = iota + 1
+	Token
+	Prefix
+	Exact
+)
+
+// Doc is an indexed document.
+type Doc struct {
+	Kind           Kind
+	MunicipalityID int64
+	// Settlement name (for both settlements and streets).
+	Settlement string
+	// Street ID and name within the settlement, for streets only.
+	StreetID int64
+	Street   string
+}
+
+// Name returns the display name of the document.
+func (d *Doc) Name() string {
+	if d.Kind == Street {
+		return d.Settlement + ", " + d.Street
+	}
+	return d.Settlement
+}
+
+// Options restrict and tune a query.
+type Options struct {
+	// Only return documents of these kinds; all kinds if empty.
+	Kinds []Kind
+	// Only return documents in these municipalities; all if empty.
+	MunicipalityIDs []int64
+	// Maximum edit distance per token for fuzzy matches; 0 disables fuzzy matching.
+	MaxEdits int
+	// Maximum number of results; 0 means no limit.
+	Limit int
+}
+
+// Result is a single search result.
+type Result struct {
+	*Doc
+	Match Match
+	// Total edit distance, for fuzzy matches.
+	Edits int
+}
+
+// Index is a search index. It is safe for concurrent queries once built.
+type Index struct {
+	docs []*Doc
+	// Folded keys for each document: the name, and for streets also the full name.
+	keys [][]string
+	// Sorted list of distinct tokens, and the documents containing each.
+	terms    []string
+	postings map[string][]int
+}
+
+// New returns an empty index.
+func New() *Index {
+	return &Index{postings: map[string][]int{}}
+}
+
+// FromDataset indexes all settlements and streets of the dataset.
+func FromDataset(ds *cadrs.Dataset) (*Index, error) {
+	ms, err := ds.Municipalities()
+	if err != nil {
+		return nil, err
+	}
+
+	docs := []*Doc{}
+	for _, m := range ms {
+		ss, err := m.Settlements()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range ss {
+			docs = append(docs, &Doc{
+				Kind:           Settlement,
+				MunicipalityID: m.Id,
+				Settlement:     s.Name,
+			})
+			for _, st := range s.Streets {
+				docs = append(docs, &Doc{
+					Kind:           Street,
+					MunicipalityID: m.Id,
+					Settlement:     s.Name,
+					StreetID:       st.Id,
+					Street:         st.Name,
+				})
+			}
+		}
+	}
+
+	idx := New()
+	idx.Add(docs...)
+	return idx, nil
+}
+
+// Add adds documents to the index.
+func (idx *Index) Add(docs ...*Doc) {
+	n := len(idx.terms)
+	for _, d := range docs {
+		idx.add(d)
+	}
+	if len(idx.terms) > n {
+		sort.Strings(idx.terms)
+	}
+}
+
+// Adds a document, appending its new terms to the (then unsorted) terms.
+func (idx *Index) add(d *Doc) {
+	id := len(idx.docs)
+	keys := []string{text.Fold(d.Name())}
+	if d.Kind == Street {
+		keys = append(keys, text.Fold(d.Street))
+	}
+	idx.docs = append(idx.docs, d)
+	idx.keys = append(idx.keys, keys)
+
+	seen := map[string]bool{}
+	for _, t := range strings.Fields(keys[0]) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		if _, ok := idx.postings[t]; !ok {
+			idx.terms = append(idx.terms, t)
+		}
+		idx.postings[t] = append(idx.postings[t], id)
+	}
+}
+
+// Search returns documents matching the query, best matches first.
+func (idx *Index) Search(query string, opts Options) []Result {
+	q := text.Fold(query)
+	tokens := strings.Fields(q)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	results := []Result{}
+	matched := map[int]bool{}
+	for _, id := range idx.intersect(tokens, idx.prefixed) {
+		if !opts.accepts(idx.docs[id]) {
+			continue
+		}
+		matched[id] = true
+		results = append(results, Result{Doc: idx.docs[id], Match: idx.classify(id, q)})
+	}
+
+	if opts.MaxEdits > 0 {
+		edits := map[int]int{}
+		within := func(t string) map[int]int {
+			ret := map[int]int{}
+			for _, term := range idx.terms {
+				d := text.Distance(t, term)
+				if d > opts.MaxEdits {
+					continue
+				}
+				for _, id := range idx.postings[term] {
+					if old, ok := ret[id]; !ok || d < old {
+						ret[id] = d
+					}
+				}
+			}
+			return ret
+		}
+		for i, t := range tokens {
+			m := within(t)
+			for id := range edits {
+				if _, ok := m[id]; !ok {
+					delete(edits, id)
+				}
+			}
+			for id, d := range m {
+				if i == 0 {
+					edits[id] = d
+				} else if old, ok := edits[id]; ok {
+					edits[id] = old + d
+				}
+			}
+		}
+		for id, d := range edits {
+			if !matched[id] && opts.accepts(idx.docs[id]) {
+				results = append(results, Result{Doc: idx.docs[id], Match: Fuzzy, Edits: d})
+			}
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Match != b.Match {
+			return a.Match > b.Match
+		}
+		if a.Edits != b.Edits {
+			return a.Edits < b.Edits
+		}
+		if an, bn := len(a.Name()), len(b.Name()); an != bn {
+			return an < bn
+		}
+		return text.AbecedaCollator.Less(a.Name(), b.Name())
+	})
+
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+
+	return results
+}
+
+// Returns documents containing a term starting with t.
+func (idx *Index) prefixed(t string) map[int]int {
+	ret := map[int]int{}
+	for i := sort.SearchStrings(idx.terms, t); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], t); i++ {
+		for _, id := range idx.postings[idx.terms[i]] {
+			ret[id] = 0
+		}
+	}
+	return ret
+}
+
+// Returns documents matched by all tokens, in index order.
+func (idx *Index) intersect(tokens []string, match func(string) map[int]int) []int {
+	var ids map[int]int
+	for _, t := range tokens {
+		m := match(t)
+		if ids == nil {
+			ids = m
+			continue
+		}
+		for id := range ids {
+			if _, ok := m[id]; !ok {
+				delete(ids, id)
+			}
+		}
+	}
+
+	ret := make([]int, 0, len(ids))
+	for id := range ids {
+		ret = append(ret, id)
+	}
+	sort.Ints(ret)
+	return ret
+}
+
+func (idx *Index) classify(id int, q string) Match {
+	best := Token
+	for _, key := range idx.keys[id] {
+		switch {
+		case key == q:
+			return Exact
+		case strings.HasPrefix(key, q):
+			best = Prefix
+		}
+	}
+	return best
+}
+
+func (o *Options) accepts(d *Doc) bool {
+	if len(o.Kinds) > 0 && !contains(o.Kinds, d.Kind) {
+		return false
+	}
+	if len(o.MunicipalityIDs) > 0 && !contains(o.MunicipalityIDs, d.MunicipalityID) {
+		return false
+	}
+	return true
+}
+
+func contains[T comparable](s []T, v T) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
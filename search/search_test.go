@@ -0,0 +1,114 @@
+package search_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/attilaolah/cad-rs/search"
+)
+
+func testIndex() *search.Index {
+	idx := search.New()
+	idx.Add(
+		&search.Doc{Kind: search.Settlement, MunicipalityID: 80438, Settlement: "NOVI SAD"},
+		&search.Doc{Kind: search.Street, MunicipalityID: 80438, Settlement: "NOVI SAD", StreetID: 1, Street: "ĐURE ĐAKOVIĆA"},
+		&search.Doc{Kind: search.Street, MunicipalityID: 80438, Settlement: "NOVI SAD", StreetID: 2, Street: "GLAVNA"},
+		&search.Doc{Kind: search.Street, MunicipalityID: 80438, Settlement: "NOVI SAD", StreetID: 3, Street: "GLAVNA POPREČNA"},
+		&search.Doc{Kind: search.Street, MunicipalityID: 80438, Settlement: "NOVI SAD", StreetID: 4, Street: "MALA GLAVNA"},
+		&search.Doc{Kind: search.Settlement, MunicipalityID: 80497, Settlement: "SUBOTICA"},
+		&search.Doc{Kind: search.Street, MunicipalityID: 80497, Settlement: "SUBOTICA", StreetID: 5, Street: "GLAVNA"},
+	)
+	return idx
+}
+
+func names(rs []search.Result) string {
+	ret := []string{}
+	for _, r := range rs {
+		ret = append(ret, r.Name())
+	}
+	return strings.Join(ret, "; ")
+}
+
+func TestSearch(t *testing.T) {
+	idx := testIndex()
+	streets := search.Options{Kinds: []search.Kind{search.Street}}
+
+	for _, c := range []struct {
+		query string
+		opts  search.Options
+		want  string
+	}{
+		// Exact matches first, then prefix, then token matches.
+		{"glavna", search.Options{}, "NOVI SAD, GLAVNA; SUBOTICA, GLAVNA; NOVI SAD, GLAVNA POPREČNA; NOVI SAD, MALA GLAVNA"},
+		{"glavna", search.Options{Limit: 2}, "NOVI SAD, GLAVNA; SUBOTICA, GLAVNA"},
+		{"glavna", search.Options{MunicipalityIDs: []int64{80497}}, "SUBOTICA, GLAVNA"},
+		{"NOVI SAD, GLAVNA", search.Options{}, "NOVI SAD, GLAVNA; NOVI SAD, GLAVNA POPREČNA; NOVI SAD, MALA GLAVNA"},
+		// Prefix matches, shorter names first.
+		{"novi", search.Options{}, "NOVI SAD; NOVI SAD, GLAVNA; NOVI SAD, MALA GLAVNA; NOVI SAD, ĐURE ĐAKOVIĆA; NOVI SAD, GLAVNA POPREČNA"},
+		{"novi", search.Options{Kinds: []search.Kind{search.Settlement}}, "NOVI SAD"},
+		// Tokens (and their prefixes) in any order.
+		{"glav novi", search.Options{}, "NOVI SAD, GLAVNA; NOVI SAD, MALA GLAVNA; NOVI SAD, GLAVNA POPREČNA"},
+		{"poprečna glavna", search.Options{}, "NOVI SAD, GLAVNA POPREČNA"},
+		// Any script, with or without diacritics.
+		{"Djure", streets, "NOVI SAD, ĐURE ĐAKOVIĆA"},
+		{"Ђуре", streets, "NOVI SAD, ĐURE ĐAKOVIĆA"},
+		{"djure djakovica", streets, "NOVI SAD, ĐURE ĐAKOVIĆA"},
+		{"Dure", streets, ""},
+		{"", search.Options{}, ""},
+		{" , ", search.Options{}, ""},
+	} {
+		if got := names(idx.Search(c.query, c.opts)); got != c.want {
+			t.Errorf("Search(%q, %+v) = %q, want %q", c.query, c.opts, got, c.want)
+		}
+	}
+}
+
+func TestSearchFuzzy(t *testing.T) {
+	idx := testIndex()
+
+	for _, c := range []struct {
+		query string
+		want  string
+		edits []int
+	}{
+		{"Dure", "NOVI SAD, ĐURE ĐAKOVIĆA", []int{1}},
+		{"dure dakovica", "NOVI SAD, ĐURE ĐAKOVIĆA", []int{2}},
+		// Fuzzy matches rank below all other matches.
+		{"glavma", "NOVI SAD, GLAVNA; SUBOTICA, GLAVNA; NOVI SAD, MALA GLAVNA; NOVI SAD, GLAVNA POPREČNA", []int{1, 1, 1, 1}},
+		{"sad glavma", "NOVI SAD, GLAVNA; NOVI SAD, MALA GLAVNA; NOVI SAD, GLAVNA POPREČNA", []int{1, 1, 1}},
+		{"subotica", "SUBOTICA; SUBOTICA, GLAVNA", []int{0, 0}},
+		{"xyz", "", nil},
+	} {
+		rs := idx.Search(c.query, search.Options{MaxEdits: 1})
+		if got := names(rs); got != c.want {
+			t.Errorf("Search(%q) = %q, want %q", c.query, got, c.want)
+			continue
+		}
+		for i, r := range rs {
+			if r.Edits != c.edits[i] {
+				t.Errorf("Search(%q)[%d].Edits = %d, want %d", c.query, i, r.Edits, c.edits[i])
+			}
+			if want := r.Edits > 0; (r.Match == search.Fuzzy) != want {
+				t.Errorf("Search(%q)[%d].Match = %v, want fuzzy: %t", c.query, i, r.Match, want)
+			}
+		}
+	}
+}
+
+// Terms added in separate calls are all found by prefix.
+func TestAddIncremental(t *testing.T) {
+	idx := search.New()
+	for _, name := range []string{"ZRENJANIN", "ADA", "ZABALJ", "APATIN"} {
+		idx.Add(&search.Doc{Kind: search.Settlement, Settlement: name})
+	}
+
+	for query, want := range map[string]string{
+		"a":  "ADA; APATIN",
+		"z":  "ZABALJ; ZRENJANIN",
+		"zr": "ZRENJANIN",
+	} {
+		if got := names(idx.Search(query, search.Options{})); got != want {
+			t.Errorf("Search(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Package service implements the CadastreService gRPC service.
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/attilaolah/cad-rs/cadrs"
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/search"
+)
+
+// Page sizes.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// Server implements pb.CadastreServiceServer backed by a dataset.
+type Server struct {
+	pb.UnimplementedCadastreServiceServer
+
+	ds *cadrs.Live
+
+	// Search index of idxDS, rebuilt when the dataset is reloaded.
+	mu    sync.Mutex
+	idx   *search.Index
+	idxDS *cadrs.Dataset
+}
+
+// New creates a new server for the dataset, which may be reloaded while serving.
+func New(ds *cadrs.Live) *Server {
+	return &Server{ds: ds}
+}
+
+// GetMunicipality implements pb.CadastreServiceServer.
+func (s *Server) GetMunicipality(ctx context.Context, req *pb.GetMunicipalityRequest) (*pb.Municipality, error) {
+	m, err := s.ds.Dataset().Municipality(req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return m.Municipality, nil
+}
+
+// ListMunicipalities implements pb.CadastreServiceServer.
+func (s *Server) ListMunicipalities(ctx context.Context, req *pb.ListMunicipalitiesRequest) (*pb.ListMunicipalitiesResponse, error) {
+	ms, err := s.ds.Dataset().Municipalities()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	start, end, next, err := paginate(len(ms), req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	res := pb.ListMunicipalitiesResponse{NextPageToken: next}
+	for _, m := range ms[start:end] {
+		res.Municipalities = append(res.Municipalities, m.Municipality)
+	}
+
+	return &res, nil
+}
+
+// GetCadastralMunicipality implements pb.CadastreServiceServer.
+func (s *Server) GetCadastralMunicipality(ctx context.Context, req *pb.GetCadastralMunicipalityRequest) (*pb.CadastralMunicipality, error) {
+	cm, err := s.ds.Dataset().CadastralMunicipality(req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return cm.CadastralMunicipality, nil
+}
+
+// SearchStreets implements pb.CadastreServiceServer.
+func (s *Server) SearchStreets(ctx context.Context, req *pb.SearchStreetsRequest) (*pb.SearchStreetsResponse, error) {
+	if req.Query == "" && req.MunicipalityId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "either query or municipality_id is required")
+	}
+
+	found, err := s.searchStreets(req.Query, req.MunicipalityId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	start, end, next, err := paginate(len(found), req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SearchStreetsResponse{
+		Streets:       found[start:end],
+		NextPageToken: next,
+	}, nil
+}
+
+// StreamSettlements implements pb.CadastreServiceServer.
+func (s *Server) StreamSettlements(req *pb.StreamSettlementsRequest, stream pb.CadastreService_StreamSettlementsServer) error {
+	m, err := s.ds.Dataset().Municipality(req.MunicipalityId)
+	if err != nil {
+		return toStatus(err)
+	}
+	ss, err := m.Settlements()
+	if err != nil {
+		return toStatus(err)
+	}
+
+	for _, s := range ss {
+		if err := stream.Send(s.Settlement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns streets matching the query, best matches first, restricted to a
+// single municipality unless mID is zero. Without a query, returns all streets
+// of the municipality.
+func (s *Server) searchStreets(q string, mID int64) ([]*pb.Street, error) {
+	ds := s.ds.Dataset()
+	if q == "" {
+		return streets(ds, mID)
+	}
+
+	idx, err := s.index(ds)
+	if err != nil {
+		return nil, err
+	}
+	opts := search.Options{Kinds: []search.Kind{search.Street}}
+	if mID != 0 {
+		opts.MunicipalityIDs = []int64{mID}
+	}
+
+	ret := []*pb.Street{}
+	for _, r := range idx.Search(q, opts) {
+		st, err := ds.Street(r.StreetID)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, st.Street)
+	}
+
+	return ret, nil
+}
+
+// Returns the search index of the dataset, building it on first use.
+func (s *Server) index(ds *cadrs.Dataset) (*search.Index, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.idxDS != ds {
+		idx, err := search.FromDataset(ds)
+		if err != nil {
+			return nil, err
+		}
+		s.idx, s.idxDS = idx, ds
+	}
+
+	return s.idx, nil
+}
+
+// Returns all streets of a municipality.
+func streets(ds *cadrs.Dataset, mID int64) ([]*pb.Street, error) {
+	ret := []*pb.Street{}
+	m, err := ds.Municipality(mID)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := m.Settlements()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		for _, st := range s.Streets {
+			ret = append(ret, st.Street)
+		}
+	}
+
+	return ret, nil
+}
+
+// Page tokens are plain offsets; clients should treat them as opaque.
+func paginate(n int, size int32, token string) (start, end int, next string, err error) {
+	if token != "" {
+		start, err = strconv.Atoi(token)
+		if err != nil || start < 0 {
+			return 0, 0, "", status.Errorf(codes.InvalidArgument, "invalid page token: %q", token)
+		}
+	}
+	if start > n {
+		start = n
+	}
+
+	switch {
+	case size < 0:
+		return 0, 0, "", status.Errorf(codes.InvalidArgument, "invalid page size: %d", size)
+	case size == 0:
+		size = DefaultPageSize
+	case size > MaxPageSize:
+		size = MaxPageSize
+	}
+
+	end = start + int(size)
+	if end >= n {
+		return start, n, "", nil
+	}
+
+	return start, end, strconv.Itoa(end), nil
+}
+
+func toStatus(err error) error {
+	if errors.Is(err, cadrs.ErrNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
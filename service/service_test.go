@@ -0,0 +1,80 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/attilaolah/cad-rs/cadrs"
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/service"
+)
+
+func testServer() *service.Server {
+	fsys := fstest.MapFS{
+		"municipalities/ids.json":   {Data: []byte(`[70017,80438]`)},
+		"municipalities/70017.json": {Data: []byte(`{"id": "70017", "name": "ALEKSANDROVAC"}`)},
+		"municipalities/80438.json": {Data: []byte(`{"id": "80438", "name": "NOVI SAD"}`)},
+		"municipalities/70017/settlements+streets.json": {Data: []byte(`[{
+			"name": "ALEKSANDROVAC",
+			"streets": [{"id": "11", "name": "GLAVNA"}]
+		}]`)},
+		"municipalities/80438/settlements+streets.json": {Data: []byte(`[{
+			"name": "NOVI SAD",
+			"streets": [
+				{"id": "1", "name": "GLAVNA"},
+				{"id": "2", "name": "ĐURE ĐAKOVIĆA"},
+				{"id": "3", "name": "GLAVNA POPREČNA"}
+			]
+		}]`)},
+	}
+	return service.New(cadrs.NewLive(func() *cadrs.Dataset { return cadrs.OpenFS(fsys) }))
+}
+
+func TestSearchStreets(t *testing.T) {
+	srv := testServer()
+
+	for _, c := range []struct {
+		query string
+		mID   int64
+		want  []int64
+	}{
+		{"Ђуре", 0, []int64{2}},
+		{"djure djak", 80438, []int64{2}},
+		{"glavna", 80438, []int64{1, 3}},
+		{"glavna", 0, []int64{1, 11, 3}},
+		{"aleksandrovac glavna", 0, []int64{11}},
+		{"", 70017, []int64{11}},
+		{"nema", 0, nil},
+	} {
+		res, err := srv.SearchStreets(context.Background(), &pb.SearchStreetsRequest{Query: c.query, MunicipalityId: c.mID})
+		if err != nil {
+			t.Errorf("SearchStreets(%q, %d): %v", c.query, c.mID, err)
+			continue
+		}
+		got := []int64{}
+		for _, st := range res.Streets {
+			got = append(got, st.Id)
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("SearchStreets(%q, %d) = %v, want %v", c.query, c.mID, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("SearchStreets(%q, %d) = %v, want %v", c.query, c.mID, got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSearchStreetsInvalid(t *testing.T) {
+	_, err := testServer().SearchStreets(context.Background(), &pb.SearchStreetsRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SearchStreets() error = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,178 @@
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	pb "github.com/attilaolah/cad-rs/proto"
+)
+
+// Kind of a change.
+type Kind string
+
+// Kinds of changes.
+const (
+	Added               Kind = "added"
+	Removed             Kind = "removed"
+	Renamed             Kind = "renamed"
+	CadastreTypeChanged Kind = "cadastre_type_changed"
+)
+
+// Entity types.
+const (
+	Municipality          = "municipality"
+	CadastralMunicipality = "cadastral_municipality"
+	Street                = "street"
+)
+
+// Change describes a single change to an entity.
+type Change struct {
+	Kind   Kind   `json:"kind"`
+	Entity string `json:"entity"`
+	ID     int64  `json:"id"`
+
+	// Parent municipality, for cadastral municipalities and streets.
+	MunicipalityID int64 `json:"municipality_id,omitempty"`
+
+	// Names (or cadastre types) before and after the change.
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// Changelog lists all changes between two snapshots.
+type Changelog struct {
+	Changes []Change `json:"changes"`
+}
+
+// Diff compares two snapshots.
+func Diff(a, b *Snapshot) *Changelog {
+	c := Changelog{Changes: []Change{}}
+
+	ams, bms := municipalities(a), municipalities(b)
+	for _, id := range union(ams, bms) {
+		am, bm := ams[id], bms[id]
+		c.compare(Municipality, id, 0, am.GetName(), bm.GetName(), am != nil, bm != nil)
+
+		acms, bcms := cadastralMunicipalities(am), cadastralMunicipalities(bm)
+		for _, cid := range union(acms, bcms) {
+			acm, bcm := acms[cid], bcms[cid]
+			c.compare(CadastralMunicipality, cid, id, acm.GetName(), bcm.GetName(), acm != nil, bcm != nil)
+			if acm != nil && bcm != nil && acm.CadastreType != bcm.CadastreType {
+				c.Changes = append(c.Changes, Change{
+					Kind:           CadastreTypeChanged,
+					Entity:         CadastralMunicipality,
+					ID:             cid,
+					MunicipalityID: id,
+					Old:            acm.CadastreType.String(),
+					New:            bcm.CadastreType.String(),
+				})
+			}
+		}
+
+		ass, bss := streets(a.Settlements[id]), streets(b.Settlements[id])
+		for _, sid := range union(ass, bss) {
+			as, bs := ass[sid], bss[sid]
+			c.compare(Street, sid, id, as.GetFullName(), bs.GetFullName(), as != nil, bs != nil)
+		}
+	}
+
+	return &c
+}
+
+// Records additions, removals and renames.
+func (c *Changelog) compare(entity string, id, mID int64, a, b string, inA, inB bool) {
+	ch := Change{
+		Entity:         entity,
+		ID:             id,
+		MunicipalityID: mID,
+	}
+
+	switch {
+	case !inA:
+		ch.Kind, ch.New = Added, b
+	case !inB:
+		ch.Kind, ch.Old = Removed, a
+	case a != b:
+		ch.Kind, ch.Old, ch.New = Renamed, a, b
+	default:
+		return
+	}
+
+	c.Changes = append(c.Changes, ch)
+}
+
+// WriteText writes a human-readable changelog, one change per line.
+func (c *Changelog) WriteText(w io.Writer) error {
+	for _, ch := range c.Changes {
+		var line string
+		switch ch.Kind {
+		case Added:
+			line = fmt.Sprintf("+ %s: %s", ch.ref(), ch.New)
+		case Removed:
+			line = fmt.Sprintf("- %s: %s", ch.ref(), ch.Old)
+		case Renamed:
+			line = fmt.Sprintf("~ %s: %s -> %s", ch.ref(), ch.Old, ch.New)
+		case CadastreTypeChanged:
+			line = fmt.Sprintf("~ %s: cadastre type %s -> %s", ch.ref(), ch.Old, ch.New)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reference to the changed entity, e.g. "street 123 (municipality 80438)".
+func (ch *Change) ref() string {
+	if ch.MunicipalityID == 0 {
+		return fmt.Sprintf("%s %d", ch.Entity, ch.ID)
+	}
+	return fmt.Sprintf("%s %d (%s %d)", ch.Entity, ch.ID, Municipality, ch.MunicipalityID)
+}
+
+func municipalities(s *Snapshot) map[int64]*pb.Municipality {
+	ret := map[int64]*pb.Municipality{}
+	for _, m := range s.Municipalities {
+		ret[m.Id] = m
+	}
+	return ret
+}
+
+func cadastralMunicipalities(m *pb.Municipality) map[int64]*pb.CadastralMunicipality {
+	ret := map[int64]*pb.CadastralMunicipality{}
+	for _, cm := range m.GetCadastralMunicipalities() {
+		ret[cm.Id] = cm
+	}
+	return ret
+}
+
+func streets(ss []*pb.Settlement) map[int64]*pb.Street {
+	ret := map[int64]*pb.Street{}
+	for _, set := range ss {
+		for _, st := range set.Streets {
+			if st.FullName == "" {
+				// Older snapshots only have the name within the settlement.
+				st = &pb.Street{Id: st.Id, FullName: set.Name + ", " + st.Name}
+			}
+			ret[st.Id] = st
+		}
+	}
+	return ret
+}
+
+// Returns the union of keys in both maps, in sorted order.
+func union[T any](a, b map[int64]T) []int64 {
+	ids := []int64{}
+	for id := range a {
+		ids = append(ids, id)
+	}
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
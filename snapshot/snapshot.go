@@ -0,0 +1,54 @@
+// Package snapshot loads and compares snapshots of scraped data.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/attilaolah/cad-rs/pbjson"
+	pb "github.com/attilaolah/cad-rs/proto"
+	"github.com/attilaolah/cad-rs/storage"
+)
+
+// Snapshot holds all scraped data from a single store.
+type Snapshot struct {
+	Municipalities []*pb.Municipality
+
+	// Settlements (including streets), keyed by municipality ID.
+	// Municipalities without scraped streets are missing.
+	Settlements map[int64][]*pb.Settlement
+}
+
+// Load reads a snapshot from the store.
+func Load(s storage.Store) (*Snapshot, error) {
+	snap := Snapshot{
+		Settlements: map[int64][]*pb.Settlement{},
+	}
+
+	if err := get(s, "municipalities+cadastral_municipalities", &snap.Municipalities); err != nil {
+		return nil, err
+	}
+
+	for _, m := range snap.Municipalities {
+		ss := []*pb.Settlement{}
+		if err := get(s, fmt.Sprintf("municipalities/%d/settlements+streets", m.Id), &ss); errors.Is(err, storage.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		snap.Settlements[m.Id] = ss
+	}
+
+	return &snap, nil
+}
+
+func get(s storage.Store, key string, v interface{}) error {
+	data, err := s.Get(key)
+	if err != nil {
+		return fmt.Errorf("failed to load %q: %w", key, err)
+	}
+	if err := pbjson.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %q: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// All keys are stored in a single bucket.
+var boltBucket = []byte("data")
+
+// Bolt is a store backed by an embedded Bolt database file.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens (or creates) a Bolt database.
+func OpenBolt(fn string) (*Bolt, error) {
+	db, err := bolt.Open(fn, 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", fn, err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create bucket in %q: %w", fn, err)
+	}
+
+	return &Bolt{db: db}, nil
+}
+
+func (b *Bolt) Put(key string, data []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), data)
+	})
+}
+
+func (b *Bolt) Get(key string) (data []byte, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltBucket).Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("%w: %q", ErrNotFound, key)
+		}
+		// Values are only valid during the transaction.
+		data = append([]byte{}, v...)
+		return nil
+	})
+	return
+}
+
+func (b *Bolt) List(prefix string) (keys []string, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		p := []byte(prefix)
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	return
+}
+
+func (b *Bolt) Delete(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// Batch starts a batch that is applied in a single transaction.
+func (b *Bolt) Batch(prefix string) (Batch, error) {
+	if err := checkPrefix(prefix); err != nil {
+		return nil, err
+	}
+
+	return newOverlay(b, prefix, func(puts map[string][]byte, dels map[string]bool) error {
+		return b.db.Update(func(tx *bolt.Tx) error {
+			bkt := tx.Bucket(boltBucket)
+			for key := range dels {
+				if err := bkt.Delete([]byte(key)); err != nil {
+					return err
+				}
+			}
+			for key, data := range puts {
+				if err := bkt.Put([]byte(key), data); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}), nil
+}
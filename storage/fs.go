@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/attilaolah/cad-rs/atomicfile"
+)
+
+// File system permissions.
+const (
+	dirPerm  = 0o755
+	filePerm = 0o644
+)
+
+// FS is a store backed by a directory tree.
+//
+// Each key maps to a file, relative to the root directory. Keys without a file
+// extension get the default extension appended, e.g. "municipalities/ids" is
+// stored as "municipalities/ids.json". So do keys already ending in the default
+// extension, so that every key maps back to itself. Files and directories starting with a
+// dot are reserved for temporary data and are never listed.
+type FS struct {
+	Root string
+	Ext  string
+}
+
+// NewFS returns a store rooted at the given directory.
+func NewFS(root, ext string) *FS {
+	return &FS{Root: root, Ext: ext}
+}
+
+func (s *FS) path(key string) (string, error) {
+	name, err := fileName(key, s.Ext)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(name)), nil
+}
+
+// Maps a key to a slash-separated file name, appending ext if needed.
+func fileName(key, ext string) (string, error) {
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", fmt.Errorf("invalid key %q", key)
+		}
+	}
+
+	if e := path.Ext(key); !isExt(e) || e == ext {
+		return key + ext, nil
+	}
+	return key, nil
+}
+
+// Whether s looks like a file extension, e.g. ".jpg". Dots within names, as in
+// "1. MAJA", do not start an extension.
+func isExt(s string) bool {
+	if len(s) < 2 {
+		return false
+	}
+	for _, r := range s[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Maps a slash-separated file name back to a key.
+func keyName(name, ext string) string {
+	if path.Ext(name) == ext {
+		return strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+func (s *FS) Put(key string, data []byte) error {
+	fn, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fn), dirPerm); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", filepath.Dir(fn), err)
+	}
+	return atomicfile.WriteFile(fn, data, filePerm)
+}
+
+func (s *FS) Get(key string) ([]byte, error) {
+	fn, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	return data, err
+}
+
+func (s *FS) List(prefix string) ([]string, error) {
+	dir := s.Root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = filepath.Join(s.Root, filepath.FromSlash(prefix[:i]))
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return []string{}, nil
+	}
+
+	keys := []string{}
+	err := filepath.WalkDir(dir, func(fn string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && fn != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.Root, fn)
+		if err != nil {
+			return err
+		}
+		key := keyName(filepath.ToSlash(rel), s.Ext)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %q: %w", dir, err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete removes the file for key, along with any parent directories left empty.
+func (s *FS) Delete(key string) error {
+	fn, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(fn); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %q: %w", fn, err)
+	}
+	for dir := filepath.Dir(fn); dir != filepath.Clean(s.Root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break // not empty
+		}
+	}
+
+	return nil
+}
+
+func (s *FS) Close() error {
+	return nil
+}
+
+// Batch starts a batch that is built in a staging directory, next to the
+// directory of prefix (or the root directory, for an empty prefix).
+// All existing files under prefix are hard-linked into the staging directory,
+// which replaces the original directory when the batch is committed. Staging
+// directories left behind by an interrupted batch of the same prefix are
+// removed first.
+func (s *FS) Batch(prefix string) (Batch, error) {
+	if err := checkPrefix(prefix); err != nil {
+		return nil, err
+	}
+	dst := filepath.Clean(s.Root)
+	if prefix != "" {
+		fn, err := s.path(strings.TrimSuffix(prefix, "/"))
+		if err != nil {
+			return nil, err
+		}
+		dst = strings.TrimSuffix(fn, s.Ext)
+	}
+	parent := filepath.Dir(dst)
+
+	if err := os.MkdirAll(parent, dirPerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory %q: %w", parent, err)
+	}
+	// Clean up after earlier batches of the same prefix that were interrupted.
+	name := "." + filepath.Base(dst) + ".batch."
+	if err := removeStaging(parent, name); err != nil {
+		return nil, err
+	}
+	if err := atomicfile.RecoverDir(dst); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(parent, name+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory in %q: %w", parent, err)
+	}
+
+	b := fsBatch{
+		FS:      FS{Root: filepath.Join(staging, "data"), Ext: s.Ext},
+		prefix:  prefix,
+		dst:     dst,
+		staging: staging,
+	}
+	if err := os.MkdirAll(b.FS.Root, dirPerm); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to create directory %q: %w", b.FS.Root, err)
+	}
+	if err := atomicfile.LinkMissing(b.FS.Root, dst); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to stage existing files from %q: %w", dst, err)
+	}
+
+	return &b, nil
+}
+
+// Removes staging directories named prefix followed by a number, as created by
+// os.MkdirTemp.
+func removeStaging(dir, prefix string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %q: %w", dir, err)
+	}
+	for _, e := range entries {
+		suffix, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || !e.IsDir() {
+			continue
+		}
+		if _, err := strconv.ParseUint(suffix, 10, 64); err != nil {
+			continue // not created by os.MkdirTemp
+		}
+		fn := filepath.Join(dir, e.Name())
+		if err := os.RemoveAll(fn); err != nil {
+			return fmt.Errorf("failed to remove %q: %w", fn, err)
+		}
+	}
+	return nil
+}
+
+// A batch of changes to a single directory.
+type fsBatch struct {
+	FS
+
+	prefix  string
+	dst     string
+	staging string
+}
+
+func (b *fsBatch) key(key string) (string, error) {
+	if !strings.HasPrefix(key, b.prefix) {
+		return "", fmt.Errorf("key %q is outside of batch prefix %q", key, b.prefix)
+	}
+	return strings.TrimPrefix(key, b.prefix), nil
+}
+
+func (b *fsBatch) Put(key string, data []byte) error {
+	key, err := b.key(key)
+	if err != nil {
+		return err
+	}
+	return b.FS.Put(key, data)
+}
+
+func (b *fsBatch) Get(key string) ([]byte, error) {
+	key, err := b.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.FS.Get(key)
+}
+
+func (b *fsBatch) List(prefix string) ([]string, error) {
+	if !strings.HasPrefix(prefix, b.prefix) {
+		return nil, fmt.Errorf("prefix %q is outside of batch prefix %q", prefix, b.prefix)
+	}
+
+	keys, err := b.FS.List(strings.TrimPrefix(prefix, b.prefix))
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = b.prefix + key
+	}
+	return keys, nil
+}
+
+func (b *fsBatch) Delete(key string) error {
+	key, err := b.key(key)
+	if err != nil {
+		return err
+	}
+	return b.FS.Delete(key)
+}
+
+// Close discards any uncommitted changes.
+func (b *fsBatch) Close() error {
+	return os.RemoveAll(b.staging)
+}
+
+func (b *fsBatch) Commit() error {
+	if err := os.MkdirAll(filepath.Dir(b.dst), dirPerm); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", filepath.Dir(b.dst), err)
+	}
+	if err := atomicfile.ReplaceDir(b.dst, b.FS.Root); err != nil {
+		return fmt.Errorf("failed to commit batch %q: %w", b.prefix, err)
+	}
+	return b.Close()
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrReadOnly is returned when writing to a read-only store.
+var ErrReadOnly = errors.New("store is read-only")
+
+// Git is a read-only store backed by a single revision of a Git repository.
+// Keys map to files the same way as they do for FS.
+type Git struct {
+	Dir string
+	Rev string
+	Ext string
+
+	once  sync.Once
+	files map[string]bool
+	err   error
+}
+
+// NewGit returns a store for the given revision of the repository at dir.
+func NewGit(dir, rev, ext string) *Git {
+	return &Git{Dir: dir, Rev: rev, Ext: ext}
+}
+
+func (g *Git) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", g.Dir}, args...)...)
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// Lists all files in the revision, once.
+func (g *Git) list() (map[string]bool, error) {
+	g.once.Do(func() {
+		out, err := g.git("ls-tree", "-r", "-z", "--name-only", g.Rev)
+		if err != nil {
+			g.err = err
+			return
+		}
+		g.files = map[string]bool{}
+		for _, name := range strings.Split(string(out), "\x00") {
+			if name != "" {
+				g.files[name] = true
+			}
+		}
+	})
+	return g.files, g.err
+}
+
+// Time returns the commit time of the revision.
+func (g *Git) Time() (time.Time, error) {
+	out, err := g.git("log", "-1", "--format=%cI", g.Rev)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(out)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse commit time of %s: %w", g.Rev, err)
+	}
+	return t, nil
+}
+
+func (g *Git) Put(key string, data []byte) error {
+	return fmt.Errorf("%w: %s@%s", ErrReadOnly, g.Dir, g.Rev)
+}
+
+func (g *Git) Get(key string) ([]byte, error) {
+	name, err := fileName(key, g.Ext)
+	if err != nil {
+		return nil, err
+	}
+	files, err := g.list()
+	if err != nil {
+		return nil, err
+	}
+	if !files[name] {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+
+	return g.git("show", g.Rev+":"+name)
+}
+
+func (g *Git) List(prefix string) ([]string, error) {
+	files, err := g.list()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for name := range files {
+		if key := keyName(name, g.Ext); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (g *Git) Delete(key string) error {
+	return fmt.Errorf("%w: %s@%s", ErrReadOnly, g.Dir, g.Rev)
+}
+
+func (g *Git) Close() error {
+	return nil
+}
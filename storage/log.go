@@ -0,0 +1,451 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/attilaolah/cad-rs/atomicfile"
+)
+
+// Record types of the log file.
+const (
+	logPut    byte = 'P'
+	logDelete byte = 'D'
+	// Records of a batch use lower-case types, and only count once followed
+	// by a commit record.
+	logBatchPut    byte = 'p'
+	logBatchDelete byte = 'd'
+	logCommit      byte = 'C'
+)
+
+// Log is a store backed by a single append-only file.
+//
+// Each record holds a type, a key and a value, followed by a checksum. Puts and
+// deletes only ever append to the file; an in-memory index of the latest value
+// of each key is built when the file is opened. Compact rewrites the file with
+// only the latest values. A partially written record at the end of the file,
+// e.g. after a crash, is discarded, as long as only zeros follow it; a corrupt
+// record anywhere else is an error.
+type Log struct {
+	mu    sync.RWMutex
+	fn    string
+	f     *os.File
+	size  int64
+	index map[string]logEntry
+	// Number of records in the file, including superseded ones.
+	records int
+}
+
+// Location of a value in the log file.
+type logEntry struct {
+	off int64
+	n   int
+}
+
+// OpenLog opens (or creates) a log file.
+func OpenLog(fn string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(fn), dirPerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory %q: %w", filepath.Dir(fn), err)
+	}
+
+	l := Log{fn: fn}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Opens the file and builds the index.
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.fn, os.O_RDWR|os.O_CREATE, filePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", l.fn, err)
+	}
+
+	index, records, size, err := readLog(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to read %q: %w", l.fn, err)
+	}
+	// Drop any incomplete record or batch at the end.
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to truncate %q: %w", l.fn, err)
+	}
+
+	l.f, l.size, l.index, l.records = f, size, index, records
+	return nil
+}
+
+// Reads all records, returning the index, the number of valid records and the
+// size of the valid part of the file.
+func readLog(f *os.File) (map[string]logEntry, int, int64, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	index := map[string]logEntry{}
+	r := bufio.NewReader(f)
+
+	var size, off int64
+	records, valid := 0, 0
+	// Records of the current batch, not yet committed.
+	pending := map[string]*logEntry{}
+	apply := func(key string, e *logEntry) {
+		if e == nil {
+			delete(index, key)
+			return
+		}
+		index[key] = *e
+	}
+
+	for {
+		typ, key, value, n, err := readRecord(r, st.Size()-off)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// End of the file, or a header cut off by it.
+			return index, valid, size, nil
+		} else if errors.Is(err, errCorrupt) {
+			// Only the last record can be partially written, the rest of the
+			// file might have been zero-filled though. A corrupt length could
+			// otherwise hide any number of valid records.
+			tail, zerr := zeros(f, off+int64(n), st.Size())
+			if zerr != nil {
+				return nil, 0, 0, zerr
+			}
+			if tail {
+				return index, valid, size, nil
+			}
+			return nil, 0, 0, fmt.Errorf("%w at offset %d", err, off)
+		} else if err != nil {
+			return nil, 0, 0, err
+		}
+		records++
+		valueOff := off + int64(n-len(value)-crc32.Size)
+		off += int64(n)
+
+		e := &logEntry{off: valueOff, n: len(value)}
+		switch typ {
+		case logPut:
+			apply(key, e)
+		case logDelete:
+			apply(key, nil)
+		case logBatchPut:
+			pending[key] = e
+		case logBatchDelete:
+			pending[key] = nil
+		case logCommit:
+			for key, e := range pending {
+				apply(key, e)
+			}
+			pending = map[string]*logEntry{}
+		default:
+			return nil, 0, 0, fmt.Errorf("unknown record type %q at offset %d", typ, off-int64(n))
+		}
+
+		if len(pending) == 0 {
+			size, valid = off, records
+		}
+	}
+}
+
+// Returned for records that are corrupt, e.g. partially written.
+var errCorrupt = errors.New("corrupt record")
+
+// Reports whether the file holds only zero bytes from off to size.
+func zeros(f *os.File, off, size int64) (bool, error) {
+	r := bufio.NewReader(io.NewSectionReader(f, off, size-off))
+	for {
+		b, err := r.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+		if b != 0 {
+			return false, nil
+		}
+	}
+}
+
+// Reads a single record of at most max bytes, returning its total size in bytes.
+// Records that would not fit are reported as corrupt, with the size of their
+// header only. The size is also returned for records with a bad checksum.
+func readRecord(r *bufio.Reader, max int64) (typ byte, key string, value []byte, n int, err error) {
+	h := crc32.NewIEEE()
+	tr := io.TeeReader(r, h)
+
+	head := make([]byte, 1)
+	if _, err = io.ReadFull(tr, head); err != nil {
+		return
+	}
+	typ = head[0]
+
+	kn, kw, err := readUvarint(tr)
+	if err != nil {
+		return
+	}
+	vn, vw, err := readUvarint(tr)
+	if err != nil {
+		return
+	}
+
+	if int64(1+kw+vw)+int64(kn)+int64(vn)+crc32.Size > max {
+		n, err = 1+kw+vw, errCorrupt
+		return
+	}
+	buf := make([]byte, kn+vn)
+	if _, err = io.ReadFull(tr, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	sum := h.Sum32()
+
+	tail := make([]byte, crc32.Size)
+	if _, err = io.ReadFull(r, tail); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	n = 1 + kw + vw + len(buf) + crc32.Size
+	if binary.BigEndian.Uint32(tail) != sum {
+		err = errCorrupt
+		return
+	}
+
+	return typ, string(buf[:kn]), buf[kn:], n, nil
+}
+
+// Reads an unsigned varint one byte at a time, returning the number of bytes read.
+// Values that do not fit in an int32 are corrupt, as no key or value is that long.
+func readUvarint(r io.Reader) (int, int, error) {
+	var x uint64
+	b := make([]byte, 1)
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		if _, err := io.ReadFull(r, b); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, 0, err
+		}
+		x |= uint64(b[0]&0x7f) << (7 * i)
+		if b[0] < 0x80 {
+			if x > math.MaxInt32 {
+				return 0, 0, errCorrupt
+			}
+			return int(x), i + 1, nil
+		}
+	}
+	return 0, 0, errCorrupt // overlong
+}
+
+// Encodes a record, returning the record and the offset of the value within it.
+func encodeRecord(typ byte, key string, value []byte) ([]byte, int) {
+	rec := []byte{typ}
+	rec = binary.AppendUvarint(rec, uint64(len(key)))
+	rec = binary.AppendUvarint(rec, uint64(len(value)))
+	rec = append(rec, key...)
+	off := len(rec)
+	rec = append(rec, value...)
+	return binary.BigEndian.AppendUint32(rec, crc32.ChecksumIEEE(rec)), off
+}
+
+// Appends records and syncs the file. Must be called with the lock held.
+func (l *Log) append(recs ...[]byte) error {
+	data := []byte{}
+	for _, rec := range recs {
+		data = append(data, rec...)
+	}
+	if _, err := l.f.WriteAt(data, l.size); err != nil {
+		return fmt.Errorf("failed to write %q: %w", l.fn, err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %q: %w", l.fn, err)
+	}
+	l.size += int64(len(data))
+	l.records += len(recs)
+	return nil
+}
+
+func (l *Log) Put(key string, data []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec, off := encodeRecord(logPut, key, data)
+	start := l.size
+	if err := l.append(rec); err != nil {
+		return err
+	}
+	l.index[key] = logEntry{off: start + int64(off), n: len(data)}
+	return nil
+}
+
+func (l *Log) Get(key string) ([]byte, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	e, ok := l.index[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	return l.read(e)
+}
+
+// Reads a value. Must be called with the lock held.
+func (l *Log) read(e logEntry) ([]byte, error) {
+	data := make([]byte, e.n)
+	if _, err := l.f.ReadAt(data, e.off); err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", l.fn, err)
+	}
+	return data, nil
+}
+
+func (l *Log) List(prefix string) ([]string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.list(prefix), nil
+}
+
+// Must be called with the lock held.
+func (l *Log) list(prefix string) []string {
+	set := map[string]bool{}
+	for key := range l.index {
+		if strings.HasPrefix(key, prefix) {
+			set[key] = true
+		}
+	}
+	return sorted(set)
+}
+
+// Scan calls fn with all keys starting with prefix and their values, in sorted order.
+func (l *Log) Scan(prefix string, fn func(key string, data []byte) error) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, key := range l.list(prefix) {
+		data, err := l.read(l.index[key])
+		if err != nil {
+			return err
+		}
+		if err := fn(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Log) Delete(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.index[key]; !ok {
+		return nil
+	}
+	rec, _ := encodeRecord(logDelete, key, nil)
+	if err := l.append(rec); err != nil {
+		return err
+	}
+	delete(l.index, key)
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.f.Close()
+}
+
+// Garbage returns the number of records that Compact would remove.
+func (l *Log) Garbage() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.records - len(l.index)
+}
+
+// Compact rewrites the log file with only the latest value of each key.
+func (l *Log) Compact() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data := []byte{}
+	index := map[string]logEntry{}
+	for _, key := range l.list("") {
+		e := l.index[key]
+		value, err := l.read(e)
+		if err != nil {
+			return err
+		}
+		rec, off := encodeRecord(logPut, key, value)
+		index[key] = logEntry{off: int64(len(data) + off), n: e.n}
+		data = append(data, rec...)
+	}
+
+	if err := atomicfile.WriteFile(l.fn, data, filePerm); err != nil {
+		return fmt.Errorf("failed to compact %q: %w", l.fn, err)
+	}
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("failed to close %q: %w", l.fn, err)
+	}
+	f, err := os.OpenFile(l.fn, os.O_RDWR, filePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", l.fn, err)
+	}
+
+	l.f, l.size, l.index, l.records = f, int64(len(data)), index, len(index)
+	return nil
+}
+
+// Batch starts a batch that is appended to the log at once.
+// The batch only takes effect once its final commit record is written.
+func (l *Log) Batch(prefix string) (Batch, error) {
+	if err := checkPrefix(prefix); err != nil {
+		return nil, err
+	}
+
+	return newOverlay(l, prefix, func(puts map[string][]byte, dels map[string]bool) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		recs := [][]byte{}
+		offs := map[string]int64{}
+		pos := l.size
+		for key := range dels {
+			rec, _ := encodeRecord(logBatchDelete, key, nil)
+			recs = append(recs, rec)
+			pos += int64(len(rec))
+		}
+		for key, data := range puts {
+			rec, off := encodeRecord(logBatchPut, key, data)
+			recs = append(recs, rec)
+			offs[key] = pos + int64(off)
+			pos += int64(len(rec))
+		}
+		commit, _ := encodeRecord(logCommit, "", nil)
+		if err := l.append(append(recs, commit)...); err != nil {
+			return err
+		}
+
+		for key := range dels {
+			delete(l.index, key)
+		}
+		for key, data := range puts {
+			l.index[key] = logEntry{off: offs[key], n: len(data)}
+		}
+		return nil
+	}), nil
+}
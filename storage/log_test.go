@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Writes a log file with one put per key-value pair, returning its name and
+// the offset of each record, followed by the size of the file.
+func writeLog(t *testing.T, kvs ...string) (string, []int64) {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), "data.log")
+	l, err := OpenLog(fn)
+	if err != nil {
+		t.Fatalf("OpenLog(): %v", err)
+	}
+	offs := []int64{0}
+	for i := 0; i < len(kvs); i += 2 {
+		put(t, l, kvs[i], kvs[i+1])
+		offs = append(offs, l.size)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close(): %v", err)
+	}
+	return fn, offs
+}
+
+// Opens a log file, returning all keys and values.
+func readAll(t *testing.T, fn string) map[string]string {
+	t.Helper()
+	l, err := OpenLog(fn)
+	if err != nil {
+		t.Fatalf("OpenLog(): %v", err)
+	}
+	defer l.Close()
+
+	ret := map[string]string{}
+	if err := l.Scan("", func(key string, data []byte) error {
+		ret[key] = string(data)
+		return nil
+	}); err != nil {
+		t.Fatalf("Scan(): %v", err)
+	}
+	return ret
+}
+
+// Replaces the contents of a file with change(contents).
+func modify(t *testing.T, fn string, change func([]byte) []byte) {
+	t.Helper()
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fn, change(data), filePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func size(t *testing.T, fn string) int64 {
+	t.Helper()
+	fi, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Size()
+}
+
+func TestLogReopen(t *testing.T) {
+	fn, _ := writeLog(t, "a", "1", "b", "2", "a", "3")
+	l, err := OpenLog(fn)
+	if err != nil {
+		t.Fatalf("OpenLog(): %v", err)
+	}
+	if err := l.Delete("b"); err != nil {
+		t.Fatalf("Delete(): %v", err)
+	}
+	if got := l.Garbage(); got != 3 {
+		t.Errorf("Garbage() = %d, want 3", got)
+	}
+	if err := l.Compact(); err != nil {
+		t.Fatalf("Compact(): %v", err)
+	}
+	l.Close()
+
+	if got, want := readAll(t, fn), map[string]string{"a": "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after Compact() = %v, want %v", got, want)
+	}
+}
+
+// A file cut within the header of its last record opens without that record.
+func TestLogTruncatedHeader(t *testing.T) {
+	fn, offs := writeLog(t, "a", "1", "b", "2")
+	// Type and key length, but no value length.
+	modify(t, fn, func(data []byte) []byte { return data[:offs[1]+2] })
+
+	if got, want := readAll(t, fn), map[string]string{"a": "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OpenLog() = %v, want %v", got, want)
+	}
+	if got := size(t, fn); got != offs[1] {
+		t.Errorf("size = %d, want %d", got, offs[1])
+	}
+}
+
+// A file cut within the key or value of its last record cannot be told apart
+// from one with a corrupt length, unless the rest of the file is zeros.
+func TestLogTruncatedRecord(t *testing.T) {
+	fn, offs := writeLog(t, "a", "1", "b", "value")
+	modify(t, fn, func(data []byte) []byte { return data[:offs[2]-crc32.Size-2] })
+
+	if _, err := OpenLog(fn); err == nil || !strings.Contains(err.Error(), "corrupt record at offset") {
+		t.Errorf("OpenLog() error = %v, want a corrupt record", err)
+	}
+	if got, want := size(t, fn), offs[2]-crc32.Size-2; got != want {
+		t.Errorf("size = %d, want %d", got, want)
+	}
+}
+
+// Zeros after the last complete record, e.g. after a crash on a file system
+// that extended the file before writing the data, are discarded.
+func TestLogZeroFilled(t *testing.T) {
+	long := strings.Repeat("2", 200)
+	for _, c := range []struct {
+		name   string
+		modify func(data []byte, offs []int64) []byte
+		want   map[string]string
+	}{{
+		name: "appended",
+		modify: func(data []byte, offs []int64) []byte {
+			return append(data, make([]byte, 4096)...)
+		},
+		want: map[string]string{"a": "1", "b": long},
+	}, {
+		name: "last record",
+		modify: func(data []byte, offs []int64) []byte {
+			for i := offs[1]; i < offs[2]; i++ {
+				data[i] = 0
+			}
+			return data
+		},
+		want: map[string]string{"a": "1"},
+	}, {
+		// Only the header of the last record made it to disk, and the
+		// zeros after it are shorter than the value.
+		name: "after the header",
+		modify: func(data []byte, offs []int64) []byte {
+			return append(data[:offs[1]+4], make([]byte, 100)...)
+		},
+		want: map[string]string{"a": "1"},
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			fn, offs := writeLog(t, "a", "1", "b", long)
+			modify(t, fn, func(data []byte) []byte { return c.modify(data, offs) })
+
+			if got := readAll(t, fn); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("OpenLog() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+// Any single flipped bit in a record that is followed by others is an error,
+// and the file is left as it was.
+func TestLogBitFlip(t *testing.T) {
+	fn, offs := writeLog(t, "a", "1", "bb", "22", "c", "3")
+	orig, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := offs[1]; i < offs[2]; i++ {
+		for bit := 0; bit < 8; bit++ {
+			data := append([]byte{}, orig...)
+			data[i] ^= 1 << bit
+			if err := os.WriteFile(fn, data, filePerm); err != nil {
+				t.Fatal(err)
+			}
+			if l, err := OpenLog(fn); err == nil {
+				l.Close()
+				t.Errorf("OpenLog() with bit %d of byte %d flipped succeeded", bit, i)
+			}
+			if got := size(t, fn); got != int64(len(data)) {
+				t.Errorf("OpenLog() with bit %d of byte %d flipped: size = %d, want %d", bit, i, got, len(data))
+			}
+		}
+	}
+}
+
+// A length too large for an int32 is an error, not a huge allocation.
+func TestLogOverlongLength(t *testing.T) {
+	fn, _ := writeLog(t, "a", "1")
+	modify(t, fn, func(data []byte) []byte {
+		// A key length of 2^32-1, an empty value, and a valid record after.
+		data = append(data, logPut, 0xff, 0xff, 0xff, 0xff, 0x0f, 0x00, 'b')
+		return append(data, record(logPut, "c", "3")...)
+	})
+
+	if _, err := OpenLog(fn); err == nil || !strings.Contains(err.Error(), "corrupt record at offset") {
+		t.Errorf("OpenLog() error = %v, want a corrupt record", err)
+	}
+}
+
+// Records of a batch without its commit record are discarded.
+func TestLogUncommittedBatch(t *testing.T) {
+	fn, offs := writeLog(t, "a", "1")
+	modify(t, fn, func(data []byte) []byte {
+		for _, rec := range [][]byte{
+			record(logBatchPut, "a", "2"),
+			record(logBatchDelete, "a", ""),
+			record(logBatchPut, "b", "2"),
+		} {
+			data = append(data, rec...)
+		}
+		// A partially written commit record.
+		return append(data, logCommit)
+	})
+
+	if got, want := readAll(t, fn), map[string]string{"a": "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OpenLog() = %v, want %v", got, want)
+	}
+	if got := size(t, fn); got != offs[1] {
+		t.Errorf("size = %d, want %d", got, offs[1])
+	}
+
+	// Writes after recovery replace the discarded records.
+	l, err := OpenLog(fn)
+	if err != nil {
+		t.Fatalf("OpenLog(): %v", err)
+	}
+	b, err := l.Batch("")
+	if err != nil {
+		t.Fatalf("Batch(): %v", err)
+	}
+	put(t, b, "b", "3")
+	if err := b.Commit(); err != nil {
+		t.Fatalf("Commit(): %v", err)
+	}
+	l.Close()
+
+	if got, want := readAll(t, fn), map[string]string{"a": "1", "b": "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OpenLog() = %v, want %v", got, want)
+	}
+}
+
+func record(typ byte, key, value string) []byte {
+	rec, _ := encodeRecord(typ, key, []byte(value))
+	return rec
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Mem is an in-memory store, mostly useful for testing.
+type Mem struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMem returns an empty in-memory store.
+func NewMem() *Mem {
+	return &Mem{data: map[string][]byte{}}
+}
+
+func (m *Mem) Put(key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *Mem) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, ok := m.data[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *Mem) List(prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := map[string]bool{}
+	for key := range m.data {
+		if strings.HasPrefix(key, prefix) {
+			set[key] = true
+		}
+	}
+	return sorted(set), nil
+}
+
+func (m *Mem) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data, key)
+	return nil
+}
+
+func (m *Mem) Close() error {
+	return nil
+}
+
+// Batch starts a batch that is applied under a single lock.
+func (m *Mem) Batch(prefix string) (Batch, error) {
+	if err := checkPrefix(prefix); err != nil {
+		return nil, err
+	}
+
+	return newOverlay(m, prefix, func(puts map[string][]byte, dels map[string]bool) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		for key := range dels {
+			delete(m.data, key)
+		}
+		for key, data := range puts {
+			m.data[key] = data
+		}
+		return nil
+	}), nil
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// An overlay is a batch that is staged in memory, on top of its parent store.
+type overlay struct {
+	parent Store
+	prefix string
+	apply  func(puts map[string][]byte, dels map[string]bool) error
+
+	mu   sync.Mutex
+	puts map[string][]byte
+	dels map[string]bool
+}
+
+func newOverlay(parent Store, prefix string, apply func(map[string][]byte, map[string]bool) error) *overlay {
+	return &overlay{
+		parent: parent,
+		prefix: prefix,
+		apply:  apply,
+		puts:   map[string][]byte{},
+		dels:   map[string]bool{},
+	}
+}
+
+func (o *overlay) check(key string) error {
+	if !strings.HasPrefix(key, o.prefix) {
+		return fmt.Errorf("key %q is outside of batch prefix %q", key, o.prefix)
+	}
+	return nil
+}
+
+func (o *overlay) Put(key string, data []byte) error {
+	if err := o.check(key); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.puts[key] = append([]byte(nil), data...)
+	delete(o.dels, key)
+	return nil
+}
+
+func (o *overlay) Get(key string) ([]byte, error) {
+	if err := o.check(key); err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	data, ok := o.puts[key]
+	deleted := o.dels[key]
+	o.mu.Unlock()
+
+	if ok {
+		return append([]byte(nil), data...), nil
+	}
+	if deleted {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	return o.parent.Get(key)
+}
+
+func (o *overlay) List(prefix string) ([]string, error) {
+	keys, err := o.parent.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	set := map[string]bool{}
+	for _, key := range keys {
+		if !o.dels[key] {
+			set[key] = true
+		}
+	}
+	for key := range o.puts {
+		if strings.HasPrefix(key, prefix) {
+			set[key] = true
+		}
+	}
+
+	return sorted(set), nil
+}
+
+func (o *overlay) Delete(key string) error {
+	if err := o.check(key); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.puts, key)
+	o.dels[key] = true
+	return nil
+}
+
+// Close discards any uncommitted changes.
+func (o *overlay) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.puts = map[string][]byte{}
+	o.dels = map[string]bool{}
+	return nil
+}
+
+func (o *overlay) Commit() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := o.apply(o.puts, o.dels); err != nil {
+		return fmt.Errorf("failed to commit batch %q: %w", o.prefix, err)
+	}
+
+	o.puts = map[string][]byte{}
+	o.dels = map[string]bool{}
+	return nil
+}
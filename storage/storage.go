@@ -0,0 +1,141 @@
+// Package storage provides key-value stores for scraped data.
+//
+// Keys are slash-separated logical names, such as
+// "municipalities/70017/cadastral_municipalities/700029". How keys map to
+// files, rows or buckets is up to the implementation.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned when a key does not exist.
+var ErrNotFound = errors.New("key not found")
+
+// Store is a key-value store.
+type Store interface {
+	// Put stores data under key, replacing any previous value.
+	Put(key string, data []byte) error
+	// Get returns the data stored under key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+	// List returns all keys starting with prefix, in sorted order.
+	List(prefix string) ([]string, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// Batch is a set of changes to all keys under a common prefix.
+// The changes only become visible when the batch is committed; batches of stores
+// implementing Batcher become visible at once.
+type Batch interface {
+	Store
+	// Commit applies all changes made to the batch.
+	Commit() error
+}
+
+// Batcher is implemented by stores that support batches.
+type Batcher interface {
+	// Batch starts a new batch for all keys under prefix.
+	// The prefix must end with a slash, or be empty to cover all keys.
+	Batch(prefix string) (Batch, error)
+}
+
+// Scanner is implemented by stores that can read many values at once.
+type Scanner interface {
+	// Scan calls fn with all keys starting with prefix and their values, in sorted order.
+	Scan(prefix string, fn func(key string, data []byte) error) error
+}
+
+// Scan calls fn with all keys starting with prefix and their values, in sorted order.
+// Stores that don't implement Scanner are read one key at a time.
+func Scan(s Store, prefix string, fn func(key string, data []byte) error) error {
+	if sc, ok := s.(Scanner); ok {
+		return sc.Scan(prefix, fn)
+	}
+
+	keys, err := s.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		data, err := s.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := fn(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewBatch starts a batch for all keys under prefix.
+// Stores that don't implement Batcher get a batch that is staged in memory and
+// applied one key at a time on commit, so a failure part-way through leaves
+// only some of the changes applied.
+func NewBatch(s Store, prefix string) (Batch, error) {
+	if err := checkPrefix(prefix); err != nil {
+		return nil, err
+	}
+	if b, ok := s.(Batcher); ok {
+		return b.Batch(prefix)
+	}
+
+	return newOverlay(s, prefix, func(puts map[string][]byte, dels map[string]bool) error {
+		for key, data := range puts {
+			if err := s.Put(key, data); err != nil {
+				return err
+			}
+		}
+		for key := range dels {
+			if err := s.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}), nil
+}
+
+// Open opens a store by name.
+// Names of the form "bolt:path/to/file.db" open a Bolt database.
+// Names of the form "log:path/to/file.log" open an append-only log file.
+// Names of the form "git:path/to/repo@rev" open a revision of a Git repository, read-only.
+// Any other name is treated as a directory, using the JSON file extension.
+func Open(name string) (Store, error) {
+	if fn, ok := strings.CutPrefix(name, "bolt:"); ok {
+		return OpenBolt(fn)
+	}
+	if fn, ok := strings.CutPrefix(name, "log:"); ok {
+		return OpenLog(fn)
+	}
+	if repo, ok := strings.CutPrefix(name, "git:"); ok {
+		i := strings.LastIndex(repo, "@")
+		if i < 0 {
+			return nil, fmt.Errorf("missing revision in %q", name)
+		}
+		return NewGit(repo[:i], repo[i+1:], ".json"), nil
+	}
+
+	return NewFS(name, ".json"), nil
+}
+
+func checkPrefix(prefix string) error {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		return fmt.Errorf("batch prefix %q must end with a slash", prefix)
+	}
+	return nil
+}
+
+func sorted(keys map[string]bool) []string {
+	ret := make([]string, 0, len(keys))
+	for key := range keys {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,430 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Stores under test, each created in a fresh temporary directory.
+var stores = map[string]func(t *testing.T) Store{
+	"mem": func(t *testing.T) Store {
+		return NewMem()
+	},
+	"fs": func(t *testing.T) Store {
+		return NewFS(t.TempDir(), ".json")
+	},
+	"bolt": func(t *testing.T) Store {
+		b, err := OpenBolt(filepath.Join(t.TempDir(), "data.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	},
+	"log": func(t *testing.T) Store {
+		l, err := OpenLog(filepath.Join(t.TempDir(), "data.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	},
+	// A store without batch support, using the in-memory fallback.
+	"fallback": func(t *testing.T) Store {
+		return struct{ Store }{NewMem()}
+	},
+}
+
+func eachStore(t *testing.T, fn func(t *testing.T, s Store)) {
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+			t.Cleanup(func() { s.Close() })
+			fn(t, s)
+		})
+	}
+}
+
+func put(t *testing.T, s Store, kvs ...string) {
+	t.Helper()
+	for i := 0; i < len(kvs); i += 2 {
+		if err := s.Put(kvs[i], []byte(kvs[i+1])); err != nil {
+			t.Fatalf("Put(%q): %v", kvs[i], err)
+		}
+	}
+}
+
+func get(t *testing.T, s Store, key string) string {
+	t.Helper()
+	data, err := s.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return "<missing>"
+	} else if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	return string(data)
+}
+
+func list(t *testing.T, s Store, prefix string) []string {
+	t.Helper()
+	keys, err := s.List(prefix)
+	if err != nil {
+		t.Fatalf("List(%q): %v", prefix, err)
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	return keys
+}
+
+func TestStore(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		put(t, s,
+			"municipalities/ids", "[70017]",
+			"municipalities/70017", "{}",
+			"municipalities/70017/cadastral_municipalities/700029", "{}",
+			"address_search/1/ab", "[]",
+		)
+		if got := get(t, s, "municipalities/70017"); got != "{}" {
+			t.Errorf("Get() = %q, want %q", got, "{}")
+		}
+		if got := get(t, s, "municipalities/1"); got != "<missing>" {
+			t.Errorf("Get() of a missing key = %q", got)
+		}
+
+		put(t, s, "municipalities/ids", "[70017,80438]")
+		if got := get(t, s, "municipalities/ids"); got != "[70017,80438]" {
+			t.Errorf("Get() after overwrite = %q", got)
+		}
+
+		want := []string{
+			"municipalities/70017",
+			"municipalities/70017/cadastral_municipalities/700029",
+			"municipalities/ids",
+		}
+		if got := list(t, s, "municipalities/"); !reflect.DeepEqual(got, want) {
+			t.Errorf("List() = %q, want %q", got, want)
+		}
+		if got := list(t, s, "municipalities/7"); !reflect.DeepEqual(got, want[:2]) {
+			t.Errorf("List() of a partial name = %q, want %q", got, want[:2])
+		}
+		if got := list(t, s, "streets/"); len(got) != 0 {
+			t.Errorf("List() of a missing prefix = %q", got)
+		}
+
+		if err := s.Delete("municipalities/70017"); err != nil {
+			t.Fatalf("Delete(): %v", err)
+		}
+		if err := s.Delete("municipalities/70017"); err != nil {
+			t.Errorf("Delete() of a missing key: %v", err)
+		}
+		if got := get(t, s, "municipalities/70017"); got != "<missing>" {
+			t.Errorf("Get() of a deleted key = %q", got)
+		}
+
+		data := map[string]string{}
+		if err := Scan(s, "municipalities/", func(key string, v []byte) error {
+			data[key] = string(v)
+			return nil
+		}); err != nil {
+			t.Fatalf("Scan(): %v", err)
+		}
+		if len(data) != 2 || data["municipalities/ids"] != "[70017,80438]" {
+			t.Errorf("Scan() = %q", data)
+		}
+	})
+}
+
+// Keys containing dots, or ending in the file extension, map back to themselves.
+func TestStoreDottedKeys(t *testing.T) {
+	keys := []string{
+		"address_search/1/1. MAJA",
+		"address_search/1/27. MARTA",
+		"address_search/1/a.b",
+		"address_search/1/x.json",
+		"address_search/1/x",
+		"address_search/1/y.jpg",
+	}
+	eachStore(t, func(t *testing.T, s Store) {
+		for _, key := range keys {
+			put(t, s, key, key)
+		}
+		for _, key := range keys {
+			if got := get(t, s, key); got != key {
+				t.Errorf("Get(%q) = %q", key, got)
+			}
+		}
+		want := append([]string{}, keys...)
+		sort.Strings(want)
+		if got := list(t, s, "address_search/"); !reflect.DeepEqual(got, want) {
+			t.Errorf("List() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestBatch(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		put(t, s,
+			"municipalities/1", "old",
+			"municipalities/2", "stale",
+			"municipalities.json", "outside",
+		)
+
+		b, err := NewBatch(s, "municipalities/")
+		if err != nil {
+			t.Fatalf("NewBatch(): %v", err)
+		}
+		defer b.Close()
+
+		put(t, b, "municipalities/1", "new", "municipalities/3", "added")
+		if err := b.Delete("municipalities/2"); err != nil {
+			t.Fatalf("Delete(): %v", err)
+		}
+		if err := b.Put("streets/1", nil); err == nil {
+			t.Error("Put() outside of the batch prefix succeeded")
+		}
+
+		// Visible within the batch only.
+		if got := get(t, b, "municipalities/1"); got != "new" {
+			t.Errorf("batch Get() = %q, want %q", got, "new")
+		}
+		if got := get(t, b, "municipalities/2"); got != "<missing>" {
+			t.Errorf("batch Get() of a deleted key = %q", got)
+		}
+		if got := list(t, b, "municipalities/"); !reflect.DeepEqual(got, []string{"municipalities/1", "municipalities/3"}) {
+			t.Errorf("batch List() = %q", got)
+		}
+		if got := get(t, s, "municipalities/1"); got != "old" {
+			t.Errorf("Get() before commit = %q, want %q", got, "old")
+		}
+
+		if err := b.Commit(); err != nil {
+			t.Fatalf("Commit(): %v", err)
+		}
+		for key, want := range map[string]string{
+			"municipalities/1":    "new",
+			"municipalities/2":    "<missing>",
+			"municipalities/3":    "added",
+			"municipalities.json": "outside",
+		} {
+			if got := get(t, s, key); got != want {
+				t.Errorf("Get(%q) after commit = %q, want %q", key, got, want)
+			}
+		}
+	})
+}
+
+func TestBatchClose(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		put(t, s, "a/1", "old")
+
+		b, err := NewBatch(s, "a/")
+		if err != nil {
+			t.Fatalf("NewBatch(): %v", err)
+		}
+		put(t, b, "a/1", "new", "a/2", "new")
+		if err := b.Close(); err != nil {
+			t.Fatalf("Close(): %v", err)
+		}
+
+		if got := list(t, s, ""); !reflect.DeepEqual(got, []string{"a/1"}) {
+			t.Errorf("List() after Close() = %q", got)
+		}
+		if got := get(t, s, "a/1"); got != "old" {
+			t.Errorf("Get() after Close() = %q, want %q", got, "old")
+		}
+	})
+}
+
+// An empty prefix covers all keys.
+func TestBatchAll(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		put(t, s, "a/1", "old", "b", "old")
+
+		b, err := NewBatch(s, "")
+		if err != nil {
+			t.Fatalf("NewBatch(): %v", err)
+		}
+		defer b.Close()
+		put(t, b, "a/1", "new", "c/1", "new")
+		if err := b.Delete("b"); err != nil {
+			t.Fatalf("Delete(): %v", err)
+		}
+		if err := b.Commit(); err != nil {
+			t.Fatalf("Commit(): %v", err)
+		}
+
+		if got := list(t, s, ""); !reflect.DeepEqual(got, []string{"a/1", "c/1"}) {
+			t.Errorf("List() = %q", got)
+		}
+		if got := get(t, s, "a/1"); got != "new" {
+			t.Errorf("Get() = %q, want %q", got, "new")
+		}
+	})
+}
+
+func TestBatchPrefix(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		if _, err := NewBatch(s, "municipalities"); err == nil {
+			t.Error("NewBatch() without a trailing slash succeeded")
+		}
+	})
+}
+
+func TestFileName(t *testing.T) {
+	for _, c := range []struct{ key, want string }{
+		{"municipalities/ids", "municipalities/ids.json"},
+		{"municipalities/70017", "municipalities/70017.json"},
+		{"address_search/1/1. MAJA", "address_search/1/1. MAJA.json"},
+		{"a/x.json", "a/x.json.json"},
+		{"a/y.jpg", "a/y.jpg"},
+		{"a/Y.JPG", "a/Y.JPG.json"},
+	} {
+		got, err := fileName(c.key, ".json")
+		if err != nil {
+			t.Errorf("fileName(%q): %v", c.key, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("fileName(%q) = %q, want %q", c.key, got, c.want)
+		}
+		if key := keyName(got, ".json"); key != c.key {
+			t.Errorf("keyName(%q) = %q, want %q", got, key, c.key)
+		}
+	}
+
+	for _, key := range []string{"", "/a", "a/../b", "a//b", "a/", ".a", "a/.b"} {
+		if _, err := fileName(key, ".json"); err == nil {
+			t.Errorf("fileName(%q) succeeded", key)
+		}
+	}
+}
+
+// Batches left behind by a crash are cleaned up by the next batch.
+func TestFSBatchCleanup(t *testing.T) {
+	root := t.TempDir()
+	s := NewFS(root, ".json")
+	put(t, s, "municipalities/1", "current")
+
+	// An interrupted batch, and an unrelated directory.
+	for _, dir := range []string{".municipalities.batch.123", ".municipalities.batch.x"} {
+		if err := os.MkdirAll(filepath.Join(root, dir, "data"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := s.Batch("municipalities/")
+	if err != nil {
+		t.Fatalf("Batch(): %v", err)
+	}
+	put(t, b, "municipalities/2", "new")
+	if err := b.Commit(); err != nil {
+		t.Fatalf("Commit(): %v", err)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{".municipalities.batch.x", "municipalities"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("entries after commit = %q, want %q", names, want)
+	}
+	if got := list(t, s, ""); !reflect.DeepEqual(got, []string{"municipalities/1", "municipalities/2"}) {
+		t.Errorf("List() = %q", got)
+	}
+}
+
+// A directory moved aside by an interrupted swap is restored.
+func TestFSBatchRecover(t *testing.T) {
+	root := t.TempDir()
+	s := NewFS(root, ".json")
+
+	old := filepath.Join(root, ".municipalities.42.old", "municipalities")
+	if err := os.MkdirAll(old, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(old, "1.json"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := s.Batch("municipalities/")
+	if err != nil {
+		t.Fatalf("Batch(): %v", err)
+	}
+	defer b.Close()
+	if got := get(t, b, "municipalities/1"); got != "old" {
+		t.Errorf("Get() = %q, want %q", got, "old")
+	}
+	if _, err := os.Stat(filepath.Join(root, ".municipalities.42.old")); !os.IsNotExist(err) {
+		t.Errorf("swap directory left behind: %v", err)
+	}
+}
+
+// Nested batches are staged next to their own directory, and never listed.
+func TestFSNestedBatch(t *testing.T) {
+	root := t.TempDir()
+	s := NewFS(root, ".json")
+	put(t, s, "municipalities/1/settlements/a", "old")
+
+	b, err := s.Batch("municipalities/1/settlements/")
+	if err != nil {
+		t.Fatalf("Batch(): %v", err)
+	}
+	defer b.Close()
+	put(t, b, "municipalities/1/settlements/b", "new")
+
+	if got := list(t, s, ""); !reflect.DeepEqual(got, []string{"municipalities/1/settlements/a"}) {
+		t.Errorf("List() before commit = %q", got)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatalf("Commit(): %v", err)
+	}
+	if got := list(t, s, ""); !reflect.DeepEqual(got, []string{"municipalities/1/settlements/a", "municipalities/1/settlements/b"}) {
+		t.Errorf("List() after commit = %q", got)
+	}
+}
+
+// Batches of all keys keep files that are not keys, e.g. when the root
+// directory is a Git working tree.
+func TestFSBatchAllKeepsDotFiles(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "dist")
+	s := NewFS(root, ".json")
+	put(t, s, "a", "old")
+	head := filepath.Join(root, ".git", "HEAD")
+	if err := os.MkdirAll(filepath.Dir(head), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(head, []byte("ref: refs/heads/main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := s.Batch("")
+	if err != nil {
+		t.Fatalf("Batch(): %v", err)
+	}
+	defer b.Close()
+	put(t, b, "a", "new")
+	if err := b.Commit(); err != nil {
+		t.Fatalf("Commit(): %v", err)
+	}
+
+	if data, err := os.ReadFile(head); err != nil || string(data) != "ref: refs/heads/main\n" {
+		t.Errorf("ReadFile(%q) = %q, %v", head, data, err)
+	}
+	if got := list(t, s, ""); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("List() = %q", got)
+	}
+	entries, err := os.ReadDir(filepath.Dir(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("staging directories left behind: %v", entries)
+	}
+}
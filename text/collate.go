@@ -0,0 +1,95 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Collator compares strings in Serbian alphabetical order.
+// Text in either script is accepted; digraphs (e.g. "Lj" or 'ǈ') sort as single letters.
+type Collator struct {
+	// Rank of each lower-case Cyrillic letter.
+	rank map[rune]int
+}
+
+var (
+	// AbecedaCollator sorts in Latin alphabet order: A B C Č Ć D Dž Đ E … Š T U V Z Ž.
+	AbecedaCollator = newCollator("abcčćdǆđefghijklǉmnǌoprsštuvzž")
+
+	// AzbukaCollator sorts in Cyrillic alphabet order: А Б В Г Д Ђ Е Ж … Ц Ч Џ Ш.
+	AzbukaCollator = newCollator("абвгдђежзијклљмнњопрстћуфхцчџш")
+)
+
+// Ranks of other characters, relative to letters.
+const (
+	rankSpace  = 0
+	rankDigit  = 1 // '0' to '9' use 1 to 10
+	rankLetter = 100
+	rankOther  = 1000 // plus the rune itself
+)
+
+func newCollator(alphabet string) *Collator {
+	c := Collator{rank: map[rune]int{}}
+	for i, r := range []rune(alphabet) {
+		if cyr, ok := lat2cyr[r]; ok {
+			r = cyr
+		} else if cyr, ok := digraphCyr[r]; ok {
+			r = cyr
+		}
+		c.rank[r] = rankLetter + i
+	}
+	return &c
+}
+
+// Compare returns -1, 0 or +1 depending on whether a sorts before, equal to or after b.
+// Strings differing only in case or script are ordered by their bytes, to keep the order total.
+func (c *Collator) Compare(a, b string) int {
+	ka, kb := c.key(a), c.key(b)
+	for i := 0; i < len(ka) && i < len(kb); i++ {
+		if ka[i] != kb[i] {
+			return sign(ka[i] - kb[i])
+		}
+	}
+	if len(ka) != len(kb) {
+		return sign(len(ka) - len(kb))
+	}
+
+	return strings.Compare(a, b)
+}
+
+// Less reports whether a sorts before b.
+func (c *Collator) Less(a, b string) bool {
+	return c.Compare(a, b) < 0
+}
+
+// Returns the primary sort key: letter ranks, ignoring case.
+func (c *Collator) key(s string) []int {
+	rs := []rune(strings.ToLower(ToCyrillic.Replace(s)))
+	ret := make([]int, 0, len(rs))
+	for _, r := range rs {
+		switch rank, ok := c.rank[r]; {
+		case ok:
+			ret = append(ret, rank)
+		case unicode.IsSpace(r) || unicode.IsPunct(r):
+			// Runs of separators count as one, so "Novi  Sad" == "Novi Sad".
+			if len(ret) == 0 || ret[len(ret)-1] != rankSpace {
+				ret = append(ret, rankSpace)
+			}
+		case r >= '0' && r <= '9':
+			ret = append(ret, rankDigit+int(r-'0'))
+		default:
+			ret = append(ret, rankOther+int(r))
+		}
+	}
+	return ret
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package text
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCollatorOrder(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		c    *Collator
+		want []string
+	}{{
+		name: "abeceda",
+		c:    AbecedaCollator,
+		want: []string{
+			"Cvet", "Čačak", "Ćuprija", "Dunav", "Džep", "Đak", "Ema",
+			"Luka", "Ljubica", "Mara", "Nuša", "Njegoš", "Ognjen",
+			"Subotica", "Šabac", "Tara", "Zrenjanin", "Žabalj",
+		},
+	}, {
+		name: "azbuka",
+		c:    AzbukaCollator,
+		want: []string{
+			"Дунав", "Ђак", "Ема", "Жабаљ", "Зрењанин",
+			"Лука", "Љубица", "Мара", "Нуша", "Његош", "Огњен",
+			"Тара", "Ћуприја", "Цвет", "Чачак", "Џеп", "Шабац",
+		},
+	}} {
+		for i := 1; i < len(c.want); i++ {
+			a, b := c.want[i-1], c.want[i]
+			if !c.c.Less(a, b) || c.c.Less(b, a) {
+				t.Errorf("%s: want %q < %q", c.name, a, b)
+			}
+		}
+
+		got := make([]string, len(c.want))
+		for i, s := range c.want {
+			got[len(got)-1-i] = s
+		}
+		sort.Slice(got, func(i, j int) bool { return c.c.Less(got[i], got[j]) })
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%s: sorted = %q, want %q", c.name, got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestCollatorCompare(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		// The same name in either script, or with digraph characters.
+		{"Ljubica", "Љубица", 0},
+		{"ǈubica", "Ljubica", 0},
+		{"Novi Sad", "novi sad", 0},
+		{"Novi  Sad", "Novi, Sad", 0},
+		// Lj and Nj are single letters, after L and N.
+		{"Lz", "Lja", -1},
+		{"Nz", "Nja", -1},
+		// Š and Ž come after all words starting with S and Z.
+		{"Szeged", "Šid", -1},
+		{"Zz", "Žabalj", -1},
+		// Digits before letters, shorter prefixes first.
+		{"Nova 5", "Nova A", -1},
+		{"Nova", "Nova 5", -1},
+	} {
+		if c.want == 0 {
+			// Only the primary keys are equal; Compare still orders by bytes.
+			if ka, kb := AbecedaCollator.key(c.a), AbecedaCollator.key(c.b); !equal(ka, kb) {
+				t.Errorf("key(%q) = %v, key(%q) = %v, want equal", c.a, ka, c.b, kb)
+			}
+			continue
+		}
+		if got := AbecedaCollator.Compare(c.a, c.b); got != c.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+var (
+	// Latin to Cyrillic map, without digraphs.
+	lat2cyr = func(m map[rune]rune) map[rune]rune {
+		ret := map[rune]rune{}
+		for k, v := range m {
+			if _, ok := digraphs[v]; !ok {
+				ret[v] = k
+				ret[unicode.ToLower(v)] = unicode.ToLower(k)
+			}
+		}
+		return ret
+	}(cyr2lat)
+
+	// Digraphs: all cases of the Unicode code points, plus the second letter
+	// of the two-letter sequences.
+	digraphCyr = map[rune]rune{
+		'Ǆ': 'Џ', 'ǅ': 'Џ', 'ǆ': 'џ',
+		'Ǉ': 'Љ', 'ǈ': 'Љ', 'ǉ': 'љ',
+		'Ǌ': 'Њ', 'ǋ': 'Њ', 'ǌ': 'њ',
+	}
+	digraphPairs = map[[2]rune]rune{
+		{'d', 'ž'}: 'џ',
+		{'l', 'j'}: 'љ',
+		{'n', 'j'}: 'њ',
+	}
+
+	// Words (or word parts) where the letter pairs "dž", "lj" and "nj" are
+	// not digraphs, but two separate letters, e.g. "nad-živeti" or "in-jekcija".
+	// Matched case-insensitively, anywhere within a word.
+	nonDigraphs = []string{
+		"nadž",    // nadživeti, nadžnjeti
+		"podž",    // podžupan, podžanr
+		"injek",   // injekcija
+		"konjug",  // konjugacija
+		"konjunk", // konjunkcija, konjunktura
+		"tanjug",
+		"vanjezi", // vanjezički
+	}
+
+	// ToCyrillic is a Latin to Cyrillic string replacer.
+	// Both the Unicode digraphs (e.g. 'ǈ') and two-letter sequences (e.g. "Lj")
+	// are converted to the single Cyrillic letter, except in known words
+	// where the letters do not form a digraph.
+	ToCyrillic = &cyrillicReplacer{}
+)
+
+type cyrillicReplacer struct{}
+
+// Replace returns a copy of s with all replacements performed.
+func (*cyrillicReplacer) Replace(s string) string {
+	rs := []rune(s)
+	b := strings.Builder{}
+	b.Grow(len(s))
+
+	for i := 0; i < len(rs); i++ {
+		if n := nonDigraphAt(rs, i); n > 0 {
+			for _, r := range rs[i : i+n] {
+				b.WriteRune(letter(r))
+			}
+			i += n - 1
+			continue
+		}
+
+		if c, ok := digraphCyr[rs[i]]; ok {
+			b.WriteRune(c)
+			continue
+		}
+		if i+1 < len(rs) {
+			pair := [2]rune{unicode.ToLower(rs[i]), unicode.ToLower(rs[i+1])}
+			if c, ok := digraphPairs[pair]; ok {
+				if unicode.IsUpper(rs[i]) {
+					c = unicode.ToUpper(c)
+				}
+				b.WriteRune(c)
+				i++
+				continue
+			}
+		}
+
+		b.WriteRune(letter(rs[i]))
+	}
+
+	return b.String()
+}
+
+// Returns the length of a non-digraph exception starting at position i, or 0.
+func nonDigraphAt(rs []rune, i int) int {
+	for _, e := range nonDigraphs {
+		n := len([]rune(e))
+		if i+n <= len(rs) && strings.ToLower(string(rs[i:i+n])) == e {
+			return n
+		}
+	}
+	return 0
+}
+
+// Converts a single letter, leaving anything else unchanged.
+func letter(r rune) rune {
+	if c, ok := lat2cyr[r]; ok {
+		return c
+	}
+	return r
+}
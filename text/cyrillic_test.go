@@ -0,0 +1,72 @@
+package text
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// Letter pairs that are spelled the same as a digraph in Latin.
+var ambiguousPairs = map[string]bool{"дж": true, "лј": true, "нј": true}
+
+func TestToCyrillicRoundTrip(t *testing.T) {
+	letters := []rune{}
+	for _, r := range Azbuka {
+		letters = append(letters, r, unicode.ToLower(r))
+	}
+
+	for _, a := range letters {
+		if got := ToCyrillic.Replace(ToLatin.Replace(string(a))); got != string(a) {
+			t.Errorf("ToCyrillic(ToLatin(%q)) = %q", a, got)
+		}
+		for _, b := range letters {
+			s := string([]rune{a, b})
+			if ambiguousPairs[strings.ToLower(s)] {
+				continue
+			}
+			if got := ToCyrillic.Replace(ToLatin.Replace(s)); got != s {
+				t.Errorf("ToCyrillic(ToLatin(%q)) = %q", s, got)
+			}
+		}
+	}
+
+	// The whole alphabet, in all cases, as well as some words.
+	azbuka := string(Azbuka)
+	for _, s := range []string{
+		azbuka,
+		strings.ToLower(azbuka),
+		"Љубав и Његош у Џепу",
+		"ЉУБАВ И ЊЕГОШ У ЏЕПУ",
+		"надживети",
+		"НАДЖИВЕТИ",
+		"Инјекција",
+		"поджупан",
+		"конјугација",
+	} {
+		if got := ToCyrillic.Replace(ToLatin.Replace(s)); got != s {
+			t.Errorf("ToCyrillic(ToLatin(%q)) = %q", s, got)
+		}
+	}
+}
+
+func TestToCyrillic(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		// Two-letter sequences and Unicode digraphs.
+		{"Ljubav i Njegoš u Džepu", "Љубав и Његош у Џепу"},
+		{"LJUBAV I NJEGOŠ U DŽEPU", "ЉУБАВ И ЊЕГОШ У ЏЕПУ"},
+		{"ǈubav i ǋegoš u ǅepu", "Љубав и Његош у Џепу"},
+		{"ǉubav", "љубав"},
+		// Letter pairs that are not digraphs.
+		{"nadživeti", "надживети"},
+		{"NADŽIVETI", "НАДЖИВЕТИ"},
+		{"injekcija", "инјекција"},
+		{"Injekcija", "Инјекција"},
+		{"konjunktura", "конјунктура"},
+		// Anything else is kept.
+		{"Ulica 27. marta, br. 5", "Улица 27. марта, бр. 5"},
+	} {
+		if got := ToCyrillic.Replace(c.in); got != c.want {
+			t.Errorf("ToCyrillic(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
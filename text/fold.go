@@ -0,0 +1,29 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+var (
+	// Folds Latin letters with diacritics to what users type on keyboards without them.
+	unaccent = strings.NewReplacer(
+		"č", "c", "ć", "c", "đ", "dj", "š", "s", "ž", "z",
+	)
+)
+
+// Fold converts text to a search key, so that the same name written in
+// Cyrillic, Gaj's Latin or diacritic-less ASCII results in the same key.
+// E.g. "Цара Душана", "Cara Dušana" and "cara dusana" all become "cara dusana".
+//
+// The key is lower-case; runs of punctuation and spaces become a single space.
+func Fold(s string) string {
+	s = ToLatin.Replace(s)
+	s = RemoveDigraphs.Replace(s)
+	s = strings.ToLower(s)
+	s = unaccent.Replace(s)
+
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
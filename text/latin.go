@@ -66,7 +66,7 @@ var (
 	}(cyr2lat)
 
 	// ToLatin is a Cyrillic to Latin string replacer.
-	// Uses Unicode digraphs so the result can be transliterated back.
+	// Uses Unicode digraphs so the result can be transliterated back (see ToCyrillic).
 	// Upper-case is translated to mixed-case digraphs. Use strings.ToUpper() to convert to all-caps.
 	ToLatin = strings.NewReplacer(func(m map[rune]rune) []string {
 		ret := []string{}
@@ -78,7 +78,8 @@ var (
 	}(cyr2lat)...)
 
 	// ToASCII transliterates text to ASCII.
-	// This should only be used to generate e.g. web-safe filenames.
+	// This should only be used to generate e.g. web-safe filenames;
+	// for user-facing text, use one of the Transliterators.
 	ToASCII = strings.NewReplacer(func(m map[rune]string) []string {
 		ret := []string{}
 		for k, v := range m {
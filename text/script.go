@@ -0,0 +1,182 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Script is the writing system of a piece of text.
+type Script int
+
+// Scripts.
+const (
+	// No letters, e.g. only digits or punctuation.
+	NoScript Script = iota
+	Latin
+	Cyrillic
+	// Both Latin and Cyrillic letters.
+	Mixed
+)
+
+func (s Script) String() string {
+	switch s {
+	case Latin:
+		return "Latin"
+	case Cyrillic:
+		return "Cyrillic"
+	case Mixed:
+		return "Mixed"
+	}
+	return "None"
+}
+
+var (
+	// Cyrillic letters that look the same as Latin ones.
+	homoglyphs = map[rune]rune{
+		'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O',
+		'Р': 'P', 'С': 'C', 'Т': 'T', 'Х': 'X', 'У': 'Y', 'Ј': 'J',
+		'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'х': 'x', 'у': 'y', 'ј': 'j',
+	}
+	// Latin letters that look the same as Cyrillic ones.
+	homoglyphsLatin = func(m map[rune]rune) map[rune]rune {
+		ret := map[rune]rune{}
+		for k, v := range m {
+			ret[v] = k
+		}
+		return ret
+	}(homoglyphs)
+)
+
+// DetectScript returns the script of the letters in s.
+func DetectScript(s string) Script {
+	lat, cyr := false, false
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			lat = true
+		case unicode.Is(unicode.Cyrillic, r):
+			cyr = true
+		}
+	}
+
+	switch {
+	case lat && cyr:
+		return Mixed
+	case lat:
+		return Latin
+	case cyr:
+		return Cyrillic
+	}
+	return NoScript
+}
+
+// Anomaly is a problem found (and fixed) by Sanitize.
+type Anomaly struct {
+	// The original and the sanitized word.
+	Word, Fixed string
+	Reason      string
+}
+
+// Anomaly reasons.
+const (
+	NotNFC      = "not NFC-normalized"
+	MixedScript = "mixed Latin and Cyrillic letters"
+)
+
+// Sanitize normalizes s to NFC and replaces look-alike letters in mixed-script
+// words with letters of the word's dominant script, e.g. a Latin "O" within a
+// Cyrillic word. Words made up of look-alikes only follow the dominant script
+// of the whole string; if that cannot be decided either, they are left unchanged.
+// It returns the sanitized string and the anomalies found.
+func Sanitize(s string) (string, []Anomaly) {
+	anomalies := []Anomaly{}
+
+	if n := norm.NFC.String(s); n != s {
+		anomalies = append(anomalies, Anomaly{Word: s, Fixed: n, Reason: NotNFC})
+		s = n
+	}
+
+	fallback := dominant([]rune(s))
+	b := strings.Builder{}
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		if DetectScript(w) == Mixed {
+			if fixed := fixHomoglyphs(word, fallback); fixed != w {
+				anomalies = append(anomalies, Anomaly{Word: w, Fixed: fixed, Reason: MixedScript})
+				w = fixed
+			}
+		}
+		b.WriteString(w)
+		word = word[:0]
+	}
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.Is(unicode.Mn, r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+
+	return b.String(), anomalies
+}
+
+// Returns the script of the majority of unambiguous letters, if any.
+func dominant(rs []rune) Script {
+	lat, cyr := 0, 0
+	for _, r := range rs {
+		_, hc := homoglyphs[r]
+		_, hl := homoglyphsLatin[r]
+		switch {
+		case hc || hl:
+			// Ambiguous.
+		case unicode.Is(unicode.Latin, r):
+			lat++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyr++
+		}
+	}
+
+	switch {
+	case cyr > lat:
+		return Cyrillic
+	case lat > cyr:
+		return Latin
+	}
+	return NoScript
+}
+
+// Converts homoglyphs to the dominant script of the word, or failing that,
+// the dominant script of the whole text.
+func fixHomoglyphs(word []rune, fallback Script) string {
+	script := dominant(word)
+	if script == NoScript {
+		script = fallback
+	}
+
+	var m map[rune]rune
+	switch script {
+	case Cyrillic:
+		m = homoglyphsLatin
+	case Latin:
+		m = homoglyphs
+	default:
+		return string(word)
+	}
+
+	ret := make([]rune, len(word))
+	for i, r := range word {
+		if c, ok := m[r]; ok {
+			r = c
+		}
+		ret[i] = r
+	}
+	return string(ret)
+}
@@ -0,0 +1,94 @@
+package text
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectScript(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want Script
+	}{
+		{"", NoScript},
+		{"1. 2/3", NoScript},
+		{"Novi Sad", Latin},
+		{"Bačka Topola", Latin},
+		{"Нови Сад", Cyrillic},
+		{"Нови Sad", Mixed},
+		// Latin N, V and I with a Cyrillic О.
+		{"NОVI", Mixed},
+	} {
+		if got := DetectScript(c.in); got != c.want {
+			t.Errorf("DetectScript(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	for _, c := range []struct {
+		name, in, want string
+		anomalies      []Anomaly
+	}{{
+		name:      "Latin O in a Cyrillic word",
+		in:        "БЕOГРАД",
+		want:      "БЕОГРАД",
+		anomalies: []Anomaly{{Word: "БЕOГРАД", Fixed: "БЕОГРАД", Reason: MixedScript}},
+	}, {
+		name:      "Cyrillic О in a Latin word",
+		in:        "NОVI SAD",
+		want:      "NOVI SAD",
+		anomalies: []Anomaly{{Word: "NОVI", Fixed: "NOVI", Reason: MixedScript}},
+	}, {
+		name:      "look-alikes only, in Cyrillic text",
+		in:        "ТРГ AКО",
+		want:      "ТРГ АКО",
+		anomalies: []Anomaly{{Word: "AКО", Fixed: "АКО", Reason: MixedScript}},
+	}, {
+		name:      "look-alikes only, in Latin text",
+		in:        "NOVI AКО",
+		want:      "NOVI AKO",
+		anomalies: []Anomaly{{Word: "AКО", Fixed: "AKO", Reason: MixedScript}},
+	}, {
+		name: "look-alikes only, script undecidable",
+		in:   "AКО",
+		want: "AКО",
+	}, {
+		name:      "not NFC",
+		in:        "Dus\u030cana",
+		want:      "Dušana",
+		anomalies: []Anomaly{{Word: "Dus\u030cana", Fixed: "Dušana", Reason: NotNFC}},
+	}, {
+		name: "NFC and mixed script",
+		in:   "ДУШАНA Dus\u030cana",
+		want: "ДУШАНА Dušana",
+		anomalies: []Anomaly{
+			{Word: "ДУШАНA Dus\u030cana", Fixed: "ДУШАНA Dušana", Reason: NotNFC},
+			{Word: "ДУШАНA", Fixed: "ДУШАНА", Reason: MixedScript},
+		},
+	}, {
+		name: "clean Latin",
+		in:   "Ulica 1. maja, Bačka Topola",
+		want: "Ulica 1. maja, Bačka Topola",
+	}, {
+		name: "clean Cyrillic",
+		in:   "Улица 1. маја, Бачка Топола",
+		want: "Улица 1. маја, Бачка Топола",
+	}, {
+		name: "clean mixed words",
+		in:   "Нови Сад, Novi Sad",
+		want: "Нови Сад, Novi Sad",
+	}, {
+		name: "empty",
+	}} {
+		got, anomalies := Sanitize(c.in)
+		if got != c.want {
+			t.Errorf("%s: Sanitize(%q) = %q, want %q", c.name, c.in, got, c.want)
+		}
+		if len(anomalies) != 0 || len(c.anomalies) != 0 {
+			if !reflect.DeepEqual(anomalies, c.anomalies) {
+				t.Errorf("%s: Sanitize(%q) anomalies = %+v, want %+v", c.name, c.in, anomalies, c.anomalies)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Transliterator converts Serbian text, in either script, to a Latin-script
+// romanisation scheme. Characters outside the Serbian alphabet are kept.
+type Transliterator struct {
+	name string
+	// Lower-case Cyrillic letter to lower-case romanisation.
+	table map[rune]string
+}
+
+var (
+	// Plain strips diacritics from Gaj's Latin: č → c, đ → d, dž → dz.
+	Plain = newTransliterator("plain", map[rune]string{
+		'ђ': "d", 'ж': "z", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'ч': "c", 'џ': "dz", 'ш': "s",
+	})
+
+	// OfficialASCII is the Serbian ASCII convention, where đ is written as dj.
+	OfficialASCII = newTransliterator("ascii", map[rune]string{
+		'ђ': "dj", 'ж': "z", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'ч': "c", 'џ': "dz", 'ш': "s",
+	})
+
+	// ISO9 is ISO 9:1995, a one-to-one mapping using combining diacritics.
+	ISO9 = newTransliterator("iso9", map[rune]string{
+		'ђ': "đ", 'ж': "ž", 'ј': "ǰ", 'љ': "l̂", 'њ': "n̂",
+		'ћ': "ć", 'ч': "č", 'џ': "d̂", 'ш': "š",
+	})
+
+	// BGNPCGN is the BGN/PCGN romanisation of Serbian, identical to Gaj's Latin.
+	BGNPCGN = newTransliterator("bgn-pcgn", map[rune]string{
+		'ђ': "đ", 'ж': "ž", 'љ': "lj", 'њ': "nj", 'ћ': "ć", 'ч': "č", 'џ': "dž", 'ш': "š",
+	})
+
+	// ICAO is the transliteration used in machine-readable travel documents (ICAO Doc 9303).
+	ICAO = newTransliterator("icao", map[rune]string{
+		'ђ': "d", 'ж': "zh", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'х': "kh",
+		'ц': "ts", 'ч': "ch", 'џ': "dz", 'ш': "sh",
+	})
+
+	// Transliterators lists all schemes, e.g. for selecting one by name.
+	Transliterators = []*Transliterator{Plain, OfficialASCII, ISO9, BGNPCGN, ICAO}
+)
+
+// Letters that are romanised the same way in all schemes.
+var common = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'з': "z",
+	'и': "i", 'ј': "j", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "c",
+}
+
+func newTransliterator(name string, table map[rune]string) *Transliterator {
+	t := Transliterator{name: name, table: map[rune]string{}}
+	for k, v := range common {
+		t.table[k] = v
+	}
+	for k, v := range table {
+		t.table[k] = v
+	}
+	return &t
+}
+
+// TransliteratorByName returns the scheme with the given name, or nil.
+func TransliteratorByName(name string) *Transliterator {
+	for _, t := range Transliterators {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the scheme.
+func (t *Transliterator) Name() string {
+	return t.name
+}
+
+// Replace returns s romanised using the scheme.
+// Upper-case letters become title-case ("Dj"), or upper-case ("DJ") next to
+// other upper-case letters.
+func (t *Transliterator) Replace(s string) string {
+	rs := []rune(ToCyrillic.Replace(s))
+	b := strings.Builder{}
+	b.Grow(len(s))
+
+	for i, r := range rs {
+		lower := unicode.ToLower(r)
+		out, ok := t.table[lower]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		if r == lower {
+			b.WriteString(out)
+			continue
+		}
+
+		if (i > 0 && isUpper(rs[i-1])) || (i+1 < len(rs) && isUpper(rs[i+1])) {
+			b.WriteString(strings.ToUpper(out))
+			continue
+		}
+		first := []rune(out)
+		first[0] = unicode.ToUpper(first[0])
+		b.WriteString(string(first))
+	}
+
+	return b.String()
+}
+
+func isUpper(r rune) bool {
+	return unicode.IsUpper(r) && unicode.IsLetter(r)
+}
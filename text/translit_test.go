@@ -0,0 +1,101 @@
+package text
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestTransliteratorsCoverage(t *testing.T) {
+	for _, tr := range Transliterators {
+		for _, r := range Azbuka {
+			for _, c := range []rune{r, unicode.ToLower(r)} {
+				cyr := string(c)
+				got := tr.Replace(cyr)
+				if got == "" || got == cyr {
+					t.Errorf("%s.Replace(%q) = %q, want a romanisation", tr.Name(), cyr, got)
+				}
+				// The same letter in Gaj's Latin is romanised the same way.
+				if lat := ToLatin.Replace(cyr); tr.Replace(lat) != got {
+					t.Errorf("%s.Replace(%q) = %q, want %q as for %q", tr.Name(), lat, tr.Replace(lat), got, cyr)
+				}
+			}
+		}
+		if got := TransliteratorByName(tr.Name()); got != tr {
+			t.Errorf("TransliteratorByName(%q) = %v, want %v", tr.Name(), got, tr)
+		}
+	}
+}
+
+func TestTransliterators(t *testing.T) {
+	for _, c := range []struct {
+		tr       *Transliterator
+		in, want string
+	}{
+		{Plain, "Ђорђе Чолић, Џеп", "Dorde Colic, Dzep"},
+		{OfficialASCII, "Ђорђе Чолић, Џеп", "Djordje Colic, Dzep"},
+		{OfficialASCII, "Bačka Topola", "Backa Topola"},
+		{OfficialASCII, "ĐURĐEVO", "DJURDJEVO"},
+		{ISO9, "Ђорђе Чолић, Џеп", "Đorđe Čolić, D\u0302ep"},
+		{ISO9, "Љубовија", "L\u0302ubovij\u030ca"},
+		{ISO9, "ЈА", "J\u030cA"},
+		{BGNPCGN, "Ђорђе Чолић, Џеп", "Đorđe Čolić, Džep"},
+		{ICAO, "Ђорђе Чолић, Џеп", "Dorde Cholic, Dzep"},
+		{ICAO, "ЖИТИШТЕ", "ZHITISHTE"},
+		{ICAO, "Хоргош", "Khorgosh"},
+	} {
+		if got := c.tr.Replace(c.in); got != c.want {
+			t.Errorf("%s.Replace(%q) = %q, want %q", c.tr.Name(), c.in, got, c.want)
+		}
+	}
+}
+
+// ISO 9 is reversible: romanising each letter differently, and never as a
+// prefix of another letter's romanisation.
+func TestISO9RoundTrip(t *testing.T) {
+	reverse := map[string]rune{}
+	for _, r := range Azbuka {
+		for _, c := range []rune{r, unicode.ToLower(r)} {
+			out := ISO9.Replace(string(c))
+			if prev, ok := reverse[out]; ok {
+				t.Errorf("ISO9 romanises both %q and %q as %q", prev, c, out)
+			}
+			reverse[out] = c
+		}
+	}
+
+	// Longest romanisations first, e.g. "ǰ" before "j".
+	outs := make([]string, 0, len(reverse))
+	for out := range reverse {
+		outs = append(outs, out)
+	}
+	sort.Slice(outs, func(i, j int) bool { return len(outs[i]) > len(outs[j]) })
+	back := func(s string) string {
+		b := strings.Builder{}
+	next:
+		for s != "" {
+			for _, out := range outs {
+				if strings.HasPrefix(s, out) {
+					b.WriteRune(reverse[out])
+					s = s[len(out):]
+					continue next
+				}
+			}
+			b.WriteByte(s[0])
+			s = s[1:]
+		}
+		return b.String()
+	}
+
+	azbuka := string(Azbuka)
+	for _, s := range []string{
+		azbuka,
+		strings.ToLower(azbuka),
+		"Љубовија, Његошева, Џеп, Ђурђево, Јагодина",
+	} {
+		if got := back(ISO9.Replace(s)); got != s {
+			t.Errorf("ISO9 round trip of %q = %q", s, got)
+		}
+	}
+}